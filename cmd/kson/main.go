@@ -0,0 +1,358 @@
+// Copyright 2012 by sdm. All rights reserved.
+// license that can be found in the LICENSE file.
+
+/*
+Kson formats, checks, queries, converts and compares kson files.
+A file is content of a hash without { and }, like files of kson.ParseFile, - or no file means stdin.
+
+Usage:
+
+	kson fmt [-l] [-indent s] [-inline n] [file ...]   reformat files in place, or print formatted stdin
+	kson check [-schema file] [file ...]               report errors with positions
+	kson get [-json] path [file]                       print values of query path, such as Roles[0].Allow
+	kson to-json [-compact] [-infer] [file]            convert kson to json
+	kson from-json [file]                              convert json to kson
+	kson diff a.kson b.kson                            print differences of two files
+
+Exit status is 1 if there are errors or differences, 2 for wrong usage.
+*/
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"github.com/sdming/kiss/kson"
+	"io"
+	"io/ioutil"
+	"os"
+)
+
+// formatOptions is the canonical format of kson files
+var formatOptions = kson.EncoderOptions{AlignValues: true, Compact: true, TrailingNewline: true, Implicit: true}
+
+// errFailed means the command has reported errors or differences itself
+var errFailed = errors.New("failed")
+
+// errUsage means arguments of the command are wrong
+var errUsage = errors.New("usage")
+
+type tool struct {
+	stdin  io.Reader
+	stdout io.Writer
+	stderr io.Writer
+}
+
+type command struct {
+	name  string
+	usage string
+	run   func(t *tool, flags *flag.FlagSet, args []string) error
+}
+
+var commands = []command{
+	{"fmt", "fmt [-l] [-indent s] [-inline n] [file ...]", (*tool).cmdFmt},
+	{"check", "check [-schema file] [file ...]", (*tool).cmdCheck},
+	{"get", "get [-json] path [file]", (*tool).cmdGet},
+	{"to-json", "to-json [-compact] [-infer] [file]", (*tool).cmdToJSON},
+	{"from-json", "from-json [file]", (*tool).cmdFromJSON},
+	{"diff", "diff a.kson b.kson", (*tool).cmdDiff},
+}
+
+func main() {
+	os.Exit(run(os.Args[1:], os.Stdin, os.Stdout, os.Stderr))
+}
+
+// run execute command of args, return exit status
+func run(args []string, stdin io.Reader, stdout, stderr io.Writer) int {
+	t := &tool{stdin: stdin, stdout: stdout, stderr: stderr}
+	if len(args) == 0 {
+		t.usage()
+		return 2
+	}
+
+	for _, c := range commands {
+		if c.name != args[0] {
+			continue
+		}
+
+		flags := flag.NewFlagSet("kson "+c.name, flag.ContinueOnError)
+		flags.SetOutput(stderr)
+		flags.Usage = func() {
+			fmt.Fprintln(stderr, "usage: kson "+c.usage)
+			flags.PrintDefaults()
+		}
+
+		switch err := c.run(t, flags, args[1:]); err {
+		case nil:
+			return 0
+		case errFailed:
+			return 1
+		case errUsage, flag.ErrHelp:
+			return 2
+		default:
+			fmt.Fprintln(stderr, err)
+			return 1
+		}
+	}
+
+	fmt.Fprintln(stderr, "kson: unknown command "+args[0])
+	t.usage()
+	return 2
+}
+
+func (t *tool) usage() {
+	fmt.Fprintln(t.stderr, "usage:")
+	for _, c := range commands {
+		fmt.Fprintln(t.stderr, "\tkson "+c.usage)
+	}
+}
+
+// parseFlags parse flags, return errUsage if count of arguments is not in [min, max], max < 0 means no limit
+func parseFlags(flags *flag.FlagSet, args []string, min, max int) error {
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+	if n := flags.NArg(); n < min || (max >= 0 && n > max) {
+		flags.Usage()
+		return errUsage
+	}
+	return nil
+}
+
+// read return content of file, - or empty name means stdin
+func (t *tool) read(name string) ([]byte, error) {
+	if name == "" || name == "-" {
+		return ioutil.ReadAll(t.stdin)
+	}
+	return ioutil.ReadFile(name)
+}
+
+// parse parse a kson file, - or empty name means stdin
+func (t *tool) parse(name string) (*kson.Document, error) {
+	if name != "" && name != "-" {
+		return kson.ParseDocumentFile(name)
+	}
+	data, err := t.read(name)
+	if err != nil {
+		return nil, err
+	}
+	return kson.ParseDocument(data)
+}
+
+// fileArg return the ith argument, or - if there are not so many
+func fileArg(flags *flag.FlagSet, i int) string {
+	if i < flags.NArg() {
+		return flags.Arg(i)
+	}
+	return "-"
+}
+
+func (t *tool) cmdFmt(flags *flag.FlagSet, args []string) error {
+	list := flags.Bool("l", false, "list files whose format differs, don't rewrite them")
+	indent := flags.String("indent", "", "indent of each level, a tab if empty")
+	inline := flags.Int("inline", 0, "write lists and hashes on one line if it's not longer than n columns")
+	if err := parseFlags(flags, args, 0, -1); err != nil {
+		return err
+	}
+
+	opts := formatOptions
+	opts.Indent = *indent
+	opts.InlineWidth = *inline
+
+	if flags.NArg() == 0 {
+		doc, err := t.parse("-")
+		if err != nil {
+			return err
+		}
+		_, err = t.stdout.Write(doc.Format(opts))
+		return err
+	}
+
+	failed := false
+	for _, name := range flags.Args() {
+		if err := t.format(name, opts, *list); err != nil {
+			fmt.Fprintln(t.stderr, err)
+			failed = true
+		}
+	}
+	if failed {
+		return errFailed
+	}
+	return nil
+}
+
+// format reformat file name in place, or print its name if list is true
+func (t *tool) format(name string, opts kson.EncoderOptions, list bool) error {
+	doc, err := t.parse(name)
+	if err != nil {
+		return err
+	}
+
+	data := doc.Format(opts)
+	if bytes.Equal(data, doc.Bytes()) {
+		return nil
+	}
+	if list {
+		fmt.Fprintln(t.stdout, name)
+		return nil
+	}
+
+	formatted, err := kson.ParseDocument(data)
+	if err != nil {
+		return fmt.Errorf("%s: formatted text is invalid: %v", name, err)
+	}
+	return formatted.Save(name)
+}
+
+func (t *tool) cmdCheck(flags *flag.FlagSet, args []string) error {
+	schemaFile := flags.String("schema", "", "validate files with schema of file")
+	if err := parseFlags(flags, args, 0, -1); err != nil {
+		return err
+	}
+
+	var schema *kson.Schema
+	if *schemaFile != "" {
+		var err error
+		if schema, err = kson.ParseSchemaFile(*schemaFile); err != nil {
+			return err
+		}
+	}
+
+	names := flags.Args()
+	if len(names) == 0 {
+		names = []string{"-"}
+	}
+
+	failed := false
+	for _, name := range names {
+		doc, err := t.parse(name)
+		if err == nil && schema != nil {
+			err = schema.Validate(doc.Root())
+		}
+		if err == nil {
+			continue
+		}
+
+		failed = true
+		if errs, ok := err.(kson.MultiError); ok {
+			for _, e := range errs {
+				fmt.Fprintln(t.stderr, e)
+			}
+		} else {
+			fmt.Fprintln(t.stderr, err)
+		}
+	}
+	if failed {
+		return errFailed
+	}
+	return nil
+}
+
+func (t *tool) cmdGet(flags *flag.FlagSet, args []string) error {
+	asJSON := flags.Bool("json", false, "print values as json")
+	if err := parseFlags(flags, args, 1, 2); err != nil {
+		return err
+	}
+
+	doc, err := t.parse(fileArg(flags, 1))
+	if err != nil {
+		return err
+	}
+	nodes, err := doc.Root().QueryAll(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	if len(nodes) == 0 {
+		return errors.New("kson get: " + flags.Arg(0) + " not found")
+	}
+
+	for _, n := range nodes {
+		var data []byte
+		switch {
+		case *asJSON:
+			data = append(n.JSON(false), '\n')
+		case n.Type == kson.NodeLiteral:
+			data = []byte(n.Literal + "\n")
+		default:
+			opts := formatOptions
+			opts.Implicit = false
+			if data, err = kson.MarshalOptions(n, opts); err != nil {
+				return err
+			}
+		}
+		if _, err := t.stdout.Write(data); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (t *tool) cmdToJSON(flags *flag.FlagSet, args []string) error {
+	compact := flags.Bool("compact", false, "don't indent json")
+	infer := flags.Bool("infer", false, "write literals which look like numbers, true, false or null as them")
+	if err := parseFlags(flags, args, 0, 1); err != nil {
+		return err
+	}
+
+	doc, err := t.parse(fileArg(flags, 0))
+	if err != nil {
+		return err
+	}
+
+	data := doc.Root().JSON(*infer)
+	if !*compact {
+		var buf bytes.Buffer
+		if err := json.Indent(&buf, data, "", "\t"); err != nil {
+			return err
+		}
+		data = buf.Bytes()
+	}
+	_, err = t.stdout.Write(append(data, '\n'))
+	return err
+}
+
+func (t *tool) cmdFromJSON(flags *flag.FlagSet, args []string) error {
+	if err := parseFlags(flags, args, 0, 1); err != nil {
+		return err
+	}
+
+	data, err := t.read(fileArg(flags, 0))
+	if err != nil {
+		return err
+	}
+	node, err := kson.ParseJSON(data)
+	if err != nil {
+		return err
+	}
+	if data, err = kson.MarshalOptions(node, formatOptions); err != nil {
+		return err
+	}
+	_, err = t.stdout.Write(data)
+	return err
+}
+
+func (t *tool) cmdDiff(flags *flag.FlagSet, args []string) error {
+	if err := parseFlags(flags, args, 2, 2); err != nil {
+		return err
+	}
+
+	a, err := t.parse(flags.Arg(0))
+	if err != nil {
+		return err
+	}
+	b, err := t.parse(flags.Arg(1))
+	if err != nil {
+		return err
+	}
+
+	diffs := kson.Diff(a.Root(), b.Root())
+	for _, d := range diffs {
+		fmt.Fprintln(t.stdout, d)
+	}
+	if len(diffs) > 0 {
+		return errFailed
+	}
+	return nil
+}
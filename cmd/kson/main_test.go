@@ -0,0 +1,148 @@
+// Copyright 2012 by sdm. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package main
+
+import (
+	"bytes"
+	"github.com/sdming/kiss/ktest"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var appData = `# app config
+Name:	app
+Port:		8000
+
+Hosts:	[
+	a.io
+	b.io
+]
+`
+
+func testRun(t *testing.T, stdin string, args ...string) (code int, stdout, stderr string) {
+	var out, errOut bytes.Buffer
+	code = run(args, strings.NewReader(stdin), &out, &errOut)
+	return code, out.String(), errOut.String()
+}
+
+func writeFile(t *testing.T, dir, name, data string) string {
+	filename := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(filename, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return filename
+}
+
+func TestFmt(t *testing.T) {
+	expect := `# app config
+Name:  app
+Port:  8000
+
+Hosts: [
+	a.io
+	b.io
+]
+`
+	code, stdout, _ := testRun(t, appData, "fmt")
+	ktest.Equal(t, "fmt stdin code", 0, code)
+	ktest.Equal(t, "fmt stdin", expect, stdout)
+
+	dir, err := ioutil.TempDir("", "kson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	filename := writeFile(t, dir, "app.kson", appData)
+
+	code, stdout, _ = testRun(t, "", "fmt", "-l", filename)
+	ktest.Equal(t, "fmt -l code", 0, code)
+	ktest.Equal(t, "fmt -l", filename+"\n", stdout)
+
+	code, _, _ = testRun(t, "", "fmt", filename)
+	ktest.Equal(t, "fmt file code", 0, code)
+	data, _ := ioutil.ReadFile(filename)
+	ktest.Equal(t, "fmt file", expect, string(data))
+
+	code, stdout, _ = testRun(t, "", "fmt", "-l", filename)
+	ktest.Equal(t, "fmt -l formatted", "", stdout)
+
+	_, stdout, _ = testRun(t, appData, "fmt", "-inline", "40")
+	ktest.Equal(t, "fmt -inline", "# app config\nName:  app\nPort:  8000\n\nHosts: [a.io, b.io]\n", stdout)
+}
+
+func TestCheck(t *testing.T) {
+	code, _, stderr := testRun(t, appData, "check")
+	ktest.Equal(t, "check code", 0, code)
+	ktest.Equal(t, "check stderr", "", stderr)
+
+	code, _, stderr = testRun(t, "Name:\tapp\nHosts:\t[\n\ta.io\n", "check")
+	ktest.Equal(t, "check error code", 1, code)
+	ktest.Equal(t, "check error", true, strings.Contains(stderr, ":"))
+
+	dir, err := ioutil.TempDir("", "kson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	schema := writeFile(t, dir, "app.schema", "keys:\t{\n\tPort:\t{\n\t\ttype:\tint\n\t\tmax:\t1024\n\t}\n}\n")
+
+	code, _, stderr = testRun(t, appData, "check", "-schema", schema)
+	ktest.Equal(t, "check schema code", 1, code)
+	ktest.Equal(t, "check schema", "3:8: Port: 8000 is greater than 1024\n", stderr)
+}
+
+func TestGet(t *testing.T) {
+	code, stdout, _ := testRun(t, appData, "get", "Hosts[1]")
+	ktest.Equal(t, "get code", 0, code)
+	ktest.Equal(t, "get", "b.io\n", stdout)
+
+	_, stdout, _ = testRun(t, appData, "get", "-json", "Hosts")
+	ktest.Equal(t, "get -json", "[\"a.io\",\"b.io\"]\n", stdout)
+
+	_, stdout, _ = testRun(t, appData, "get", "Hosts")
+	ktest.Equal(t, "get list", "[\n\ta.io\n\tb.io\n]\n", stdout)
+
+	code, _, _ = testRun(t, appData, "get", "Missing")
+	ktest.Equal(t, "get missing code", 1, code)
+
+	code, _, _ = testRun(t, appData, "get")
+	ktest.Equal(t, "get usage code", 2, code)
+}
+
+func TestConvert(t *testing.T) {
+	code, stdout, _ := testRun(t, appData, "to-json", "-compact", "-infer")
+	ktest.Equal(t, "to-json code", 0, code)
+	ktest.Equal(t, "to-json", `{"Name":"app","Port":8000,"Hosts":["a.io","b.io"]}`+"\n", stdout)
+
+	code, stdout, _ = testRun(t, `{"Name":"app","Port":8000,"Hosts":["a.io","b.io"]}`, "from-json")
+	ktest.Equal(t, "from-json code", 0, code)
+	ktest.Equal(t, "from-json", "Name:  app\nPort:  8000\nHosts: [\n\ta.io\n\tb.io\n]\n", stdout)
+}
+
+func TestDiff(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	a := writeFile(t, dir, "a.kson", appData)
+	b := writeFile(t, dir, "b.kson", strings.Replace(appData, "8000", "9000", 1))
+
+	code, stdout, _ := testRun(t, "", "diff", a, a)
+	ktest.Equal(t, "diff same code", 0, code)
+	ktest.Equal(t, "diff same", "", stdout)
+
+	code, stdout, _ = testRun(t, "", "diff", a, b)
+	ktest.Equal(t, "diff code", 1, code)
+	ktest.Equal(t, "diff", "~ Port: \"8000\" -> \"9000\"\n", stdout)
+}
+
+func TestUnknownCommand(t *testing.T) {
+	code, _, stderr := testRun(t, "", "lint")
+	ktest.Equal(t, "unknown code", 2, code)
+	ktest.Equal(t, "unknown", true, strings.HasPrefix(stderr, "kson: unknown command lint"))
+}
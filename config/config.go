@@ -0,0 +1,277 @@
+// Copyright 2012 by sdm. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package config
+
+import (
+	"errors"
+	"github.com/sdming/kiss/kson"
+	"os"
+	"reflect"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// DefaultInterval is the default interval of checking file
+const DefaultInterval = time.Second
+
+// Validator is implemented by config types which can check themselves after loading
+type Validator interface {
+	Validate() error
+}
+
+// Options controls how a config file is loaded
+type Options struct {
+	Interval    time.Duration                    // interval of checking modify time of file, DefaultInterval if 0
+	Strict      bool                             // unknown keys and bad literals are errors, see kson.UnmarshalStrict
+	Include     bool                             // resolve include directives, see kson.ParseFileInclude
+	Interpolate bool                             // resolve ${...}, see kson.Node.Interpolate
+	Validate    func(v interface{}) error        // called after Validator of the value
+	OnError     func(filename string, err error) // called when reloading by Watch fails
+}
+
+// Config holds the current value of a kson file.
+// Values returned by Get are replaced as a whole when file changes, they should not be modified.
+type Config struct {
+	filename  string
+	prototype reflect.Value // pointer to defaults
+	options   Options
+
+	value     atomic.Value // pointer to current value
+	reloading sync.Mutex   // serializes reloading
+
+	mu      sync.Mutex // protects fields below
+	subs    []func(old, new interface{})
+	modTime time.Time
+	size    int64
+	stop    chan bool
+	done    chan bool
+}
+
+// New load filename into a copy of prototype, prototype is a pointer to struct which holds default values
+func New(filename string, prototype interface{}, options Options) (*Config, error) {
+	v := reflect.ValueOf(prototype)
+	if v.Kind() != reflect.Ptr || v.IsNil() {
+		return nil, errors.New("config: prototype should be a non-nil pointer")
+	}
+	if options.Interval <= 0 {
+		options.Interval = DefaultInterval
+	}
+
+	c := &Config{filename: filename, prototype: v, options: options}
+	if err := c.Reload(); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// Filename return name of config file
+func (c *Config) Filename() string {
+	return c.filename
+}
+
+// Get return current value, it's a pointer of the same type as prototype
+func (c *Config) Get() interface{} {
+	return c.value.Load()
+}
+
+// Subscribe add a func which is called with old and new value after config is reloaded, fn should not call Reload
+func (c *Config) Subscribe(fn func(old, new interface{})) {
+	c.mu.Lock()
+	c.subs = append(c.subs, fn)
+	c.mu.Unlock()
+}
+
+// Reload load file again, current value is kept if file can not be loaded or validated
+func (c *Config) Reload() error {
+	c.reloading.Lock()
+	defer c.reloading.Unlock()
+
+	fi, err := os.Stat(c.filename)
+	if err != nil {
+		return err
+	}
+	// remember the file even it's bad, so Watch waits for next change
+	c.mu.Lock()
+	c.modTime, c.size = fi.ModTime(), fi.Size()
+	c.mu.Unlock()
+
+	v, err := c.load()
+	if err != nil {
+		return err
+	}
+
+	old := c.value.Load()
+	c.value.Store(v)
+	if old == nil {
+		return nil
+	}
+
+	c.mu.Lock()
+	subs := c.subs
+	c.mu.Unlock()
+	for _, fn := range subs {
+		fn(old, v)
+	}
+	return nil
+}
+
+// load parse, decode and validate file
+func (c *Config) load() (interface{}, error) {
+	var node *kson.Node
+	var err error
+	if c.options.Include {
+		node, err = kson.ParseFileInclude(c.filename)
+	} else {
+		node, err = kson.ParseFile(c.filename)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if c.options.Interpolate {
+		if err = node.Interpolate(nil); err != nil {
+			return nil, err
+		}
+	}
+
+	v := reflect.New(c.prototype.Type().Elem())
+	deepCopy(v.Elem(), c.prototype.Elem())
+	x := v.Interface()
+
+	if c.options.Strict {
+		err = node.ValueStrict(x)
+	} else {
+		err = node.Value(x)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	if validator, ok := x.(Validator); ok {
+		if err = validator.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if c.options.Validate != nil {
+		if err = c.options.Validate(x); err != nil {
+			return nil, err
+		}
+	}
+	return x, nil
+}
+
+// deepCopy copy src to dst, pointers, maps and slices of src are copied too, so values never share defaults
+func deepCopy(dst, src reflect.Value) {
+	switch src.Kind() {
+	case reflect.Ptr:
+		if src.IsNil() {
+			dst.Set(src)
+			return
+		}
+		dst.Set(reflect.New(src.Type().Elem()))
+		deepCopy(dst.Elem(), src.Elem())
+	case reflect.Interface:
+		if src.IsNil() {
+			dst.Set(src)
+			return
+		}
+		x := reflect.New(src.Elem().Type()).Elem()
+		deepCopy(x, src.Elem())
+		dst.Set(x)
+	case reflect.Struct:
+		dst.Set(src)
+		for i := 0; i < src.NumField(); i++ {
+			if dst.Field(i).CanSet() {
+				deepCopy(dst.Field(i), src.Field(i))
+			}
+		}
+	case reflect.Map:
+		if src.IsNil() {
+			dst.Set(src)
+			return
+		}
+		m := reflect.MakeMap(src.Type())
+		for _, key := range src.MapKeys() {
+			x := reflect.New(src.Type().Elem()).Elem()
+			deepCopy(x, src.MapIndex(key))
+			m.SetMapIndex(key, x)
+		}
+		dst.Set(m)
+	case reflect.Slice:
+		if src.IsNil() {
+			dst.Set(src)
+			return
+		}
+		dst.Set(reflect.MakeSlice(src.Type(), src.Len(), src.Len()))
+		for i := 0; i < src.Len(); i++ {
+			deepCopy(dst.Index(i), src.Index(i))
+		}
+	case reflect.Array:
+		for i := 0; i < src.Len(); i++ {
+			deepCopy(dst.Index(i), src.Index(i))
+		}
+	default:
+		dst.Set(src)
+	}
+}
+
+// changed return true if modify time or size of file is changed since last loading
+func (c *Config) changed() bool {
+	fi, err := os.Stat(c.filename)
+	if err != nil {
+		return false
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return !fi.ModTime().Equal(c.modTime) || fi.Size() != c.size
+}
+
+// Watch start checking file by Options.Interval, file is reloaded when it's changed
+func (c *Config) Watch() {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.stop != nil {
+		return
+	}
+
+	c.stop, c.done = make(chan bool), make(chan bool)
+	go c.watch(c.stop, c.done)
+}
+
+func (c *Config) watch(stop, done chan bool) {
+	defer close(done)
+
+	ticker := time.NewTicker(c.options.Interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-stop:
+			return
+		case <-ticker.C:
+			if !c.changed() {
+				continue
+			}
+			if err := c.Reload(); err != nil && c.options.OnError != nil {
+				c.options.OnError(c.filename, err)
+			}
+		}
+	}
+}
+
+// Close stop watching file
+func (c *Config) Close() error {
+	c.mu.Lock()
+	stop, done := c.stop, c.done
+	c.stop, c.done = nil, nil
+	c.mu.Unlock()
+
+	if stop != nil {
+		close(stop)
+		<-done
+	}
+	return nil
+}
@@ -0,0 +1,113 @@
+// Copyright 2012 by sdm. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package config_test
+
+import (
+	"errors"
+	"github.com/sdming/kiss/config"
+	"github.com/sdming/kiss/ktest"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+type AppConfig struct {
+	Log_Level string
+	Listen    int
+	Env       map[string]string
+}
+
+func (c *AppConfig) Validate() error {
+	if c.Listen <= 0 || c.Listen > 65535 {
+		return errors.New("invalid Listen")
+	}
+	return nil
+}
+
+func writeFile(t *testing.T, filename string, data string, modTime time.Time) {
+	if err := ioutil.WriteFile(filename, []byte(data), 0644); err != nil {
+		t.Fatal("write file error", err)
+	}
+	os.Chtimes(filename, modTime, modTime)
+}
+
+func TestConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "config")
+	if err != nil {
+		t.Fatal("create temp dir error", err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "app.kson")
+	now := time.Now()
+	writeFile(t, filename, "Log_Level:\tdebug\nEnv:\t{\n\ta:\t1\n}\n", now)
+
+	prototype := &AppConfig{Listen: 8000, Env: map[string]string{"default": "x"}}
+	errs := make(chan error, 10)
+	c, err := config.New(filename, prototype, config.Options{
+		Interval: 10 * time.Millisecond,
+		OnError:  func(filename string, err error) { errs <- err },
+	})
+	if err != nil {
+		t.Fatal("new config error", err)
+	}
+
+	v := c.Get().(*AppConfig)
+	ktest.Equal(t, "Log_Level", "debug", v.Log_Level)
+	ktest.Equal(t, "default Listen", 8000, v.Listen)
+	ktest.Equal(t, "default of map", "x", v.Env["default"])
+	ktest.Equal(t, "map", "1", v.Env["a"])
+	ktest.Equal(t, "prototype is not modified", 1, len(prototype.Env))
+
+	changes := make(chan [2]*AppConfig, 10)
+	c.Subscribe(func(old, new interface{}) {
+		changes <- [2]*AppConfig{old.(*AppConfig), new.(*AppConfig)}
+	})
+	c.Watch()
+	defer c.Close()
+
+	// good change
+	writeFile(t, filename, "Log_Level:\tinfo\nListen:\t9000\n", now.Add(time.Second))
+	select {
+	case x := <-changes:
+		ktest.Equal(t, "old", "debug", x[0].Log_Level)
+		ktest.Equal(t, "new", "info", x[1].Log_Level)
+		ktest.Equal(t, "new Listen", 9000, x[1].Listen)
+		ktest.Equal(t, "Get", x[1], c.Get().(*AppConfig))
+	case <-time.After(2 * time.Second):
+		t.Fatal("change is not notified")
+	}
+
+	// bad file keeps the previous good config
+	writeFile(t, filename, "Log_Level:\t{\n", now.Add(2*time.Second))
+	select {
+	case err := <-errs:
+		t.Log(err)
+	case <-time.After(2 * time.Second):
+		t.Fatal("error is not reported")
+	}
+	ktest.Equal(t, "keep good config", "info", c.Get().(*AppConfig).Log_Level)
+
+	// invalid value
+	writeFile(t, filename, "Listen:\t70000\n", now.Add(3*time.Second))
+	select {
+	case err := <-errs:
+		ktest.Equal(t, "Validate", "invalid Listen", err.Error())
+	case <-time.After(2 * time.Second):
+		t.Fatal("validate error is not reported")
+	}
+	ktest.Equal(t, "keep valid config", 9000, c.Get().(*AppConfig).Listen)
+	ktest.Equal(t, "no more changes", 0, len(changes))
+}
+
+func TestConfigError(t *testing.T) {
+	if _, err := config.New("not_exists.kson", &AppConfig{}, config.Options{}); err == nil {
+		t.Error("new config of missing file should fail")
+	}
+	if _, err := config.New("not_exists.kson", AppConfig{}, config.Options{}); err == nil {
+		t.Error("new config of non-pointer prototype should fail")
+	}
+}
@@ -0,0 +1,21 @@
+// Copyright 2012 by sdm. All rights reserved.
+// license that can be found in the LICENSE file.
+
+/*
+Package config loads a kson file into a typed struct, and reloads it when the file changes
+
+	c, err := config.New("app.kson", &AppConfig{Listen: 8000}, config.Options{})
+	if err != nil {
+		log.Fatal(err)
+	}
+	c.Subscribe(func(old, new interface{}) {
+		log.Println("config changed", old.(*AppConfig).Listen, new.(*AppConfig).Listen)
+	})
+	c.Watch()
+	defer c.Close()
+
+	app := c.Get().(*AppConfig)
+
+*/
+
+package config
@@ -20,7 +20,7 @@ func TestStructValue(t *testing.T) {
 		except := reflect.ValueOf(data).FieldByName(name).Interface()
 		actual, ok := v.Get(name)
 		if !ok {
-			t.Errorf("get field %s %s", name, ok)
+			t.Errorf("get field %s %v", name, ok)
 		} else if except != actual.Interface() {
 			t.Errorf("get field %s fail, except %#v actual %#v", name, except, actual)
 		}
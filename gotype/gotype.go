@@ -8,6 +8,7 @@ import (
 	"reflect"
 	"runtime"
 	"strings"
+	"time"
 )
 
 const (
@@ -41,6 +42,8 @@ var (
 	TypeFloat64   = reflect.TypeOf(float64(0))
 	TypeString    = reflect.TypeOf("")
 	TypeByteSlice = reflect.TypeOf([]byte(nil))
+	TypeDuration  = reflect.TypeOf(time.Duration(0))
+	TypeTime      = reflect.TypeOf(time.Time{})
 )
 
 // returns the name of the calling method
@@ -0,0 +1,47 @@
+// Copyright 2012 by sdm. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package gotype
+
+import (
+	"strconv"
+	"time"
+)
+
+// TimeLayouts are layouts tried in order by ParseTime if no layout is given, it can be changed at init
+var TimeLayouts = []string{
+	time.RFC3339Nano,
+	"2006-01-02T15:04:05",
+	"2006-01-02 15:04:05Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+}
+
+// ParseTime parse s by layouts in order, TimeLayouts if layouts is empty, error of the first layout is returned if all fail
+func ParseTime(s string, layouts ...string) (t time.Time, err error) {
+	if len(layouts) == 0 {
+		layouts = TimeLayouts
+	}
+	for i, layout := range layouts {
+		x, e := time.Parse(layout, s)
+		if e == nil {
+			return x, nil
+		}
+		if i == 0 {
+			err = e
+		}
+	}
+	return
+}
+
+// ParseDuration parse s like 30s or 1h30m, a plain integer is nanoseconds
+func ParseDuration(s string) (time.Duration, error) {
+	d, err := time.ParseDuration(s)
+	if err == nil {
+		return d, nil
+	}
+	if i, e := strconv.ParseInt(s, 0, 64); e == nil {
+		return time.Duration(i), nil
+	}
+	return 0, err
+}
@@ -7,6 +7,7 @@ import (
 	"fmt"
 	"reflect"
 	"strconv"
+	"time"
 )
 
 // Value is a alias of reflect.Value
@@ -214,70 +215,95 @@ func (v Value) Set(x reflect.Value) {
 	}
 }
 
-// Parse value from a string
+// Parse value from a string, v is unchanged if s can not be converted
 func (rv Value) Parse(s string) {
+	rv.TryParse(s)
+}
+
+// TryParse parse value from a string, return error if s can not be converted to kind of v
+func (rv Value) TryParse(s string) (err error) {
 
 	v := rv.Value()
 	if !v.IsValid() || !v.CanSet() {
-		return
+		return newTypeErr(methodName(), "value can not be set", v)
 	}
 
 	if v.Kind() == reflect.String {
 		v.SetString(s)
 		return
 	}
+
+	switch v.Type() {
+	case TypeDuration:
+		var d time.Duration
+		if d, err = ParseDuration(s); err == nil {
+			v.SetInt(int64(d))
+		}
+		return
+	case TypeTime:
+		var t time.Time
+		if t, err = ParseTime(s); err == nil {
+			v.Set(reflect.ValueOf(t))
+		}
+		return
+	}
+
+	var i int64
+	var u uint64
+	var f float64
+	var b bool
 	switch v.Kind() {
 	case reflect.Bool:
-		if b, err := strconv.ParseBool(s); err == nil {
+		if b, err = strconv.ParseBool(s); err == nil {
 			v.SetBool(b)
 		}
 	case reflect.Int:
-		if i, err := strconv.ParseInt(s, 0, 32); err == nil {
+		if i, err = strconv.ParseInt(s, 0, 32); err == nil {
 			v.SetInt(i)
 		}
 	case reflect.Int8:
-		if i, err := strconv.ParseInt(s, 0, 8); err == nil {
+		if i, err = strconv.ParseInt(s, 0, 8); err == nil {
 			v.SetInt(i)
 		}
 	case reflect.Int16:
-		if i, err := strconv.ParseInt(s, 0, 16); err == nil {
+		if i, err = strconv.ParseInt(s, 0, 16); err == nil {
 			v.SetInt(i)
 		}
 	case reflect.Int32:
-		if i, err := strconv.ParseInt(s, 0, 32); err == nil {
+		if i, err = strconv.ParseInt(s, 0, 32); err == nil {
 			v.SetInt(i)
 		}
 	case reflect.Int64:
-		if i, err := strconv.ParseInt(s, 0, 64); err == nil {
+		if i, err = strconv.ParseInt(s, 0, 64); err == nil {
 			v.SetInt(i)
 		}
 	case reflect.Uint:
-		if i, err := strconv.ParseUint(s, 0, 0); err == nil {
-			v.SetUint(i)
+		if u, err = strconv.ParseUint(s, 0, 0); err == nil {
+			v.SetUint(u)
 		}
 	case reflect.Uint8:
-		if i, err := strconv.ParseUint(s, 0, 8); err == nil {
-			v.SetUint(i)
+		if u, err = strconv.ParseUint(s, 0, 8); err == nil {
+			v.SetUint(u)
 		}
 	case reflect.Uint16:
-		if i, err := strconv.ParseUint(s, 0, 16); err == nil {
-			v.SetUint(i)
+		if u, err = strconv.ParseUint(s, 0, 16); err == nil {
+			v.SetUint(u)
 		}
 	case reflect.Uint32:
-		if i, err := strconv.ParseUint(s, 0, 32); err == nil {
-			v.SetUint(i)
+		if u, err = strconv.ParseUint(s, 0, 32); err == nil {
+			v.SetUint(u)
 		}
 	case reflect.Uint64:
-		if i, err := strconv.ParseUint(s, 0, 64); err == nil {
-			v.SetUint(i)
+		if u, err = strconv.ParseUint(s, 0, 64); err == nil {
+			v.SetUint(u)
 		}
 	case reflect.Float32:
-		if i, err := strconv.ParseFloat(s, 32); err == nil {
-			v.SetFloat(i)
+		if f, err = strconv.ParseFloat(s, 32); err == nil {
+			v.SetFloat(f)
 		}
 	case reflect.Float64:
-		if i, err := strconv.ParseFloat(s, 64); err == nil {
-			v.SetFloat(i)
+		if f, err = strconv.ParseFloat(s, 64); err == nil {
+			v.SetFloat(f)
 		}
 	case reflect.Interface:
 		// if i, err := strconv.ParseFloat(s, 64); err != nil {
@@ -286,11 +312,23 @@ func (rv Value) Parse(s string) {
 		v.Set(reflect.ValueOf(string(s)))
 	default:
 		//TODO
+		err = newTypeErr(methodName(), "unsupported kind "+v.Kind().String(), v)
 	}
+	return
 }
 
 func (v Value) Format() string {
 	inner := v.Underlying()
+	if inner.IsValid() {
+		switch inner.Type() {
+		case TypeDuration:
+			return time.Duration(inner.Int()).String()
+		case TypeTime:
+			if inner.CanInterface() {
+				return inner.Interface().(time.Time).Format(time.RFC3339Nano)
+			}
+		}
+	}
 	switch UnderlyingKind(inner) {
 	case reflect.Bool:
 		return strconv.FormatBool(inner.Bool())
@@ -8,6 +8,7 @@ import (
 	"github.com/sdming/kiss/gotype"
 	"reflect"
 	"testing"
+	"time"
 )
 
 func testFieldsValue(t *testing.T, v reflect.Value, fields []string, fn func(v gotype.Value) bool) {
@@ -15,7 +16,7 @@ func testFieldsValue(t *testing.T, v reflect.Value, fields []string, fn func(v g
 		fv := v.FieldByName(field)
 		k := gotype.Value(fv)
 		if ok := fn(k); !ok {
-			t.Errorf("field %s testing fail - %#v ", field, fn)
+			t.Errorf("field %s testing fail - %#v ", field, fv)
 		}
 	}
 }
@@ -183,3 +184,38 @@ func TestValueIsSimple(t *testing.T) {
 	testFieldsValue(t, reflect.ValueOf(data), fields,
 		func(v gotype.Value) bool { return v.IsSimple() })
 }
+
+func TestValueTryParse(t *testing.T) {
+	var i8 int8
+	var u uint
+	var f float64
+	var b bool
+
+	v := gotype.ValueOf(&i8).Underlying()
+	test(t, gotype.Value(v).TryParse("-8") == nil && i8 == -8, "TryParse int8")
+	test(t, gotype.Value(v).TryParse("300") != nil && i8 == -8, "TryParse int8 overflow")
+	test(t, gotype.Value(reflect.ValueOf(&u).Elem()).TryParse("80a") != nil, "TryParse uint invalid")
+	test(t, gotype.Value(reflect.ValueOf(&f).Elem()).TryParse("6.4") == nil && f == 6.4, "TryParse float64")
+	test(t, gotype.Value(reflect.ValueOf(&b).Elem()).TryParse("yes") != nil, "TryParse bool invalid")
+	test(t, gotype.Value(reflect.ValueOf(b)).TryParse("true") != nil, "TryParse can not set")
+}
+
+func TestValueTime(t *testing.T) {
+	var d time.Duration
+	var tm time.Time
+
+	v := reflect.ValueOf(&d).Elem()
+	test(t, gotype.Value(v).TryParse("1m30s") == nil && d == 90*time.Second, "TryParse duration")
+	test(t, gotype.Value(v).TryParse("1000") == nil && d == time.Microsecond, "TryParse duration nanoseconds")
+	test(t, gotype.Value(v).TryParse("30x") != nil, "TryParse duration invalid")
+	test(t, gotype.Value(v).Format() == "1µs", "Format duration")
+
+	v = reflect.ValueOf(&tm).Elem()
+	test(t, gotype.Value(v).TryParse("2012-12-21") == nil && tm.Equal(time.Date(2012, 12, 21, 0, 0, 0, 0, time.UTC)), "TryParse date")
+	test(t, gotype.Value(v).TryParse("2012-12-21T08:30:00+08:00") == nil && tm.Hour() == 8, "TryParse RFC3339")
+	test(t, gotype.Value(v).TryParse("21/12/2012") != nil, "TryParse time invalid")
+	test(t, gotype.Value(v).Format() == "2012-12-21T08:30:00+08:00", "Format time")
+
+	_, err := gotype.ParseTime("21/12/2012", "02/01/2006")
+	test(t, err == nil, "ParseTime layout")
+}
@@ -0,0 +1,346 @@
+// Copyright 2012 by sdm. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package kson
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// inferLiteral convert literal to bool, int64, float64 or nil if it looks like one, otherwise return it as string
+func inferLiteral(s string) interface{} {
+	switch s {
+	case "true":
+		return true
+	case "false":
+		return false
+	case "null":
+		return nil
+	}
+	if !isNumber(s) {
+		return s
+	}
+	if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+		return i
+	}
+	if f, err := strconv.ParseFloat(s, 64); err == nil {
+		return f
+	}
+	return s
+}
+
+// isInferred return true if inferLiteral convert s to other type than string
+func isInferred(s string) bool {
+	return s == "true" || s == "false" || s == "null" || isNumber(s)
+}
+
+// isNumber return true if s is a number in json syntax, such as -1, 0.5 or 1e10
+func isNumber(s string) bool {
+	i := 0
+	if i < len(s) && s[i] == '-' {
+		i++
+	}
+	digits := func() int {
+		start := i
+		for i < len(s) && s[i] >= '0' && s[i] <= '9' {
+			i++
+		}
+		return i - start
+	}
+
+	if i < len(s) && s[i] == '0' {
+		i++
+	} else if digits() == 0 {
+		return false
+	}
+	if i < len(s) && s[i] == '.' {
+		i++
+		if digits() == 0 {
+			return false
+		}
+	}
+	if i < len(s) && (s[i] == 'e' || s[i] == 'E') {
+		i++
+		if i < len(s) && (s[i] == '+' || s[i] == '-') {
+			i++
+		}
+		if digits() == 0 {
+			return false
+		}
+	}
+	return i == len(s)
+}
+
+// Interface return value of node as string, []interface{} or map[string]interface{},
+// literals are converted to bool, int64, float64 or nil if infer is true
+func (n *Node) Interface(infer bool) interface{} {
+	switch n.Type {
+	case NodeLiteral:
+		if infer {
+			return inferLiteral(n.Literal)
+		}
+		return n.Literal
+	case NodeList:
+		data := make([]interface{}, len(n.List))
+		for i, child := range n.List {
+			data[i] = child.Interface(infer)
+		}
+		return data
+	case NodeHash:
+		data := make(map[string]interface{}, len(n.Hash))
+		for name, child := range n.Hash {
+			data[name] = child.Interface(infer)
+		}
+		return data
+	}
+	return nil
+}
+
+// JSON return node as json, keys of hash are in source order.
+// Literals are strings, unless infer is true and literal is true, false, null or a number.
+func (n *Node) JSON(infer bool) []byte {
+	var buf bytes.Buffer
+	n.writeJSON(&buf, infer)
+	return buf.Bytes()
+}
+
+// MarshalJSON implements json.Marshaler, literals are strings
+func (n *Node) MarshalJSON() ([]byte, error) {
+	return n.JSON(false), nil
+}
+
+// UnmarshalJSON implements json.Unmarshaler, see ParseJSON
+func (n *Node) UnmarshalJSON(data []byte) error {
+	node, err := ParseJSON(data)
+	if err != nil {
+		return err
+	}
+	*n = *node
+	return nil
+}
+
+func (n *Node) writeJSON(buf *bytes.Buffer, infer bool) {
+	switch n.Type {
+	case NodeLiteral:
+		if infer && isInferred(n.Literal) {
+			buf.WriteString(n.Literal)
+		} else {
+			writeJSONString(buf, n.Literal)
+		}
+	case NodeList:
+		buf.WriteByte('[')
+		for i, child := range n.List {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			child.writeJSON(buf, infer)
+		}
+		buf.WriteByte(']')
+	case NodeHash:
+		buf.WriteByte('{')
+		for i, name := range n.orderedKeys() {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			writeJSONString(buf, name)
+			buf.WriteByte(':')
+			n.Hash[name].writeJSON(buf, infer)
+		}
+		buf.WriteByte('}')
+	default:
+		buf.WriteString("null")
+	}
+}
+
+// writeJSONString write s as a json string, it's also a valid double-quoted yaml string
+func writeJSONString(buf *bytes.Buffer, s string) {
+	const hex = "0123456789abcdef"
+	buf.WriteByte('"')
+	for i := 0; i < len(s); {
+		c := s[i]
+		if c < utf8.RuneSelf {
+			switch {
+			case c == '"' || c == '\\':
+				buf.WriteByte('\\')
+				buf.WriteByte(c)
+			case c == '\n':
+				buf.WriteString(`\n`)
+			case c == '\r':
+				buf.WriteString(`\r`)
+			case c == '\t':
+				buf.WriteString(`\t`)
+			case c < 0x20 || c == 0x7f:
+				buf.WriteString(`\u00`)
+				buf.WriteByte(hex[c>>4])
+				buf.WriteByte(hex[c&0xf])
+			default:
+				buf.WriteByte(c)
+			}
+			i++
+			continue
+		}
+
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if r == utf8.RuneError && size == 1 {
+			buf.WriteString(`\ufffd`)
+		} else {
+			buf.WriteString(s[i : i+size])
+		}
+		i += size
+	}
+	buf.WriteByte('"')
+}
+
+// ParseJSON convert json to node, numbers and bools become literals of their text, null becomes null node.
+// Keys of object are kept in source order.
+func ParseJSON(data []byte) (*Node, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+
+	node, err := jsonNode(dec)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := dec.Token(); err != io.EOF {
+		if err == nil {
+			err = errors.New("invalid json, data after top level value")
+		}
+		return nil, err
+	}
+	return node, nil
+}
+
+func jsonNode(dec *json.Decoder) (*Node, error) {
+	tok, err := dec.Token()
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	switch x := tok.(type) {
+	case json.Delim:
+		var node *Node
+		if x == '[' {
+			node = &Node{Type: NodeList, List: make([]*Node, 0, capacity)}
+		} else {
+			node = newHash()
+		}
+
+		for dec.More() {
+			var name string
+			if node.Type == NodeHash {
+				if tok, err = dec.Token(); err != nil {
+					return nil, err
+				}
+				name, _ = tok.(string)
+			}
+
+			child, err := jsonNode(dec)
+			if err != nil {
+				return nil, err
+			}
+			if node.Type == NodeHash {
+				node.put(name, child)
+			} else {
+				node.List = append(node.List, child)
+			}
+		}
+
+		// ] or }
+		if _, err = dec.Token(); err != nil {
+			return nil, err
+		}
+		return node, nil
+	case string:
+		return &Node{Type: NodeLiteral, Literal: x}, nil
+	case json.Number:
+		return &Node{Type: NodeLiteral, Literal: string(x)}, nil
+	case bool:
+		return &Node{Type: NodeLiteral, Literal: strconv.FormatBool(x)}, nil
+	}
+	return &Node{Type: NodeNull}, nil
+}
+
+// ParseINI convert ini data to node, each section is a hash of root.
+// Section name like [a.b] creates nested hashes, keys before the first section belong to root.
+// key = value and key: value are both supported, lines start with ; or # are comments.
+func ParseINI(data []byte) (*Node, error) {
+	root := newHash()
+	section := root
+
+	lines := strings.Split(string(data), "\n")
+	for i, line := range lines {
+		line = strings.TrimSpace(line)
+		if line == "" || line[0] == ';' || line[0] == '#' {
+			continue
+		}
+
+		pos := Position{Line: i + 1, Column: 1}
+		if line[0] == '[' {
+			if line[len(line)-1] != ']' {
+				return nil, &FormatError{Message: "section is not closed", Pos: pos}
+			}
+
+			section = root
+			for _, name := range strings.Split(line[1:len(line)-1], ".") {
+				name = strings.TrimSpace(name)
+				if name == "" {
+					return nil, &FormatError{Message: "section name is empty", Pos: pos}
+				}
+				child, ok := section.Child(name)
+				if !ok {
+					child = newHash()
+					child.Pos = pos
+					section.put(name, child)
+				} else if child.Type != NodeHash {
+					return nil, &FormatError{Message: "section " + name + " is not a hash", Pos: pos}
+				}
+				section = child
+			}
+			continue
+		}
+
+		sep := strings.IndexAny(line, "=:")
+		if sep <= 0 {
+			return nil, &FormatError{Message: "expect key = value", Pos: pos}
+		}
+		name, value := strings.TrimSpace(line[:sep]), strings.TrimSpace(line[sep+1:])
+		value, err := iniValue(value)
+		if err != nil {
+			return nil, &FormatError{Message: err.Error(), Pos: pos}
+		}
+		section.put(name, &Node{Type: NodeLiteral, Literal: value, Pos: pos})
+	}
+	return root, nil
+}
+
+// iniValue unquote value, or remove comment after " ;" or " #"
+func iniValue(s string) (string, error) {
+	if s == "" {
+		return s, nil
+	}
+	switch s[0] {
+	case '"':
+		return strconv.Unquote(s)
+	case '\'':
+		if len(s) < 2 || s[len(s)-1] != '\'' {
+			return "", errors.New("invalid quoted value " + s)
+		}
+		return s[1 : len(s)-1], nil
+	}
+
+	for _, mark := range []string{" ;", "\t;", " #", "\t#"} {
+		if i := strings.Index(s, mark); i >= 0 {
+			s = strings.TrimSpace(s[:i])
+		}
+	}
+	return s, nil
+}
@@ -0,0 +1,220 @@
+// Copyright 2012 by sdm. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package kson_test
+
+import (
+	"encoding/json"
+	"github.com/sdming/kiss/kson"
+	"github.com/sdming/kiss/ktest"
+	"testing"
+)
+
+func TestNodeJSON(t *testing.T) {
+	node, err := kson.Parse([]byte(defaultConfigString))
+	if err != nil {
+		t.Error("parse error", err)
+		return
+	}
+
+	data := string(node.JSON(false))
+	expect := `{"Log_Level":"debug","Listen":"8000","Roles":[{"Name":"user","Allow":["/user","/order"]},{"Name":"*","Deny":["/user","/order"]}],` +
+		`"Db_Log":{"Driver":"mysql","Host":"127.0.0.1","User":"user","Password":"password","Database":"log"},` +
+		`"Env":{"auth":"http://auth.io","browser":"ie, chrome, firefox, safari","key":""}}`
+	ktest.Equal(t, "JSON", expect, data)
+
+	infer := node.JSON(true)
+	var c Config
+	if err := json.Unmarshal(infer, &c); err != nil {
+		t.Error("json unmarshal of inferred json error", err)
+		return
+	}
+	ktest.Equal(t, "Listen", 8000, c.Listen)
+	ktest.Equal(t, "Roles[0].Allow[1]", "/order", c.Roles[0].Allow[1])
+
+	// MarshalJSON is used by encoding/json
+	b, err := json.Marshal(map[string]*kson.Node{"node": node.MustChild("Db_Log")})
+	ktest.Equal(t, "MarshalJSON", `{"node":{"Driver":"mysql","Host":"127.0.0.1","User":"user","Password":"password","Database":"log"}}`, string(b))
+}
+
+func TestParseJSON(t *testing.T) {
+	data := `{"z":1.5e3,"a":[true,null,"x\ty",{"k":"v"}],"m":{}}`
+	node, err := kson.ParseJSON([]byte(data))
+	if err != nil {
+		t.Error("ParseJSON error", err)
+		return
+	}
+
+	ktest.Equal(t, "keys", "[z a m]", fmtKeys(node.Keys))
+	ktest.Equal(t, "number", "1.5e3", node.ChildString("z"))
+	s, _ := node.QueryString("a[0]")
+	ktest.Equal(t, "bool", "true", s)
+	s, err = node.QueryString("a[1]")
+	ktest.Equal(t, "null", "", s)
+	_, ok := err.(*kson.InvalidNodeTypeError)
+	ktest.Equal(t, "null is not a literal", true, ok)
+	x, _ := node.Query("a[1]")
+	ktest.Equal(t, "null", true, x.IsNull())
+	s, _ = node.QueryString("a[3].k")
+	ktest.Equal(t, "object in array", "v", s)
+	ktest.Equal(t, "back to json", data, string(node.JSON(true)))
+
+	// json to kson text and back
+	b, err := kson.Marshal(node)
+	if err != nil {
+		t.Error("marshal node error", err)
+		return
+	}
+	back, err := kson.Parse(b)
+	if err != nil {
+		t.Error("parse marshaled node error", err, string(b))
+		return
+	}
+	s, _ = back.QueryString("a[*].k")
+	ktest.Equal(t, "round trip", "v", s)
+	ktest.Equal(t, "round trip", data, string(back.JSON(true)))
+
+	for _, bad := range []string{"", "{", `{"a":1}x`, `[1,]`} {
+		if _, err := kson.ParseJSON([]byte(bad)); err == nil {
+			t.Errorf("ParseJSON %q should fail", bad)
+		}
+	}
+
+	var n kson.Node
+	if err := json.Unmarshal([]byte(`["a","b"]`), &n); err != nil || len(n.List) != 2 {
+		t.Error("UnmarshalJSON fail", err, n)
+	}
+}
+
+func TestNodeInterface(t *testing.T) {
+	node, _ := kson.Parse([]byte("{\n\ta:\t1\n\tb:\t[\n\t\t2.5\n\t\tfalse\n\t\tx\n\t]\n}"))
+
+	v := node.Interface(true).(map[string]interface{})
+	ktest.Equal(t, "int", int64(1), v["a"])
+	list := v["b"].([]interface{})
+	ktest.Equal(t, "float", 2.5, list[0])
+	ktest.Equal(t, "bool", false, list[1])
+	ktest.Equal(t, "string", "x", list[2])
+
+	v = node.Interface(false).(map[string]interface{})
+	ktest.Equal(t, "no infer", "1", v["a"])
+}
+
+var iniData = `
+; global
+name = app
+[db]
+host = 127.0.0.1   ; comment
+port: 3306
+password = "p;ss word"
+
+[db.replica]
+host = 10.0.0.2
+`
+
+func TestParseINI(t *testing.T) {
+	node, err := kson.ParseINI([]byte(iniData))
+	if err != nil {
+		t.Error("ParseINI error", err)
+		return
+	}
+
+	ktest.Equal(t, "keys", "[name db]", fmtKeys(node.Keys))
+	s, _ := node.QueryString("db.host")
+	ktest.Equal(t, "host", "127.0.0.1", s)
+	i, _ := node.QueryInt("db.port")
+	ktest.Equal(t, "port", int64(3306), i)
+	s, _ = node.QueryString("db.password")
+	ktest.Equal(t, "quoted", "p;ss word", s)
+	s, _ = node.QueryString("db.replica.host")
+	ktest.Equal(t, "nested section", "10.0.0.2", s)
+
+	_, err = kson.ParseINI([]byte("[db\nhost=x"))
+	if err == nil || err.Error() != "1:1: section is not closed" {
+		t.Error("ParseINI should report position of error", err)
+	}
+
+	for _, bad := range []string{"[]\nhost=x", "[db.]\nhost=x", "[ ]\nhost=x"} {
+		_, err = kson.ParseINI([]byte(bad))
+		if _, ok := err.(*kson.FormatError); !ok || err.Error() != "1:1: section name is empty" {
+			t.Errorf("ParseINI %q should fail with empty section name, actual %v", bad, err)
+		}
+	}
+}
+
+func TestNodeYAML(t *testing.T) {
+	node, err := kson.Parse([]byte(defaultConfigString))
+	if err != nil {
+		t.Error("parse error", err)
+		return
+	}
+
+	data := string(node.YAML(true))
+	expect := `Log_Level: debug
+Listen: 8000
+Roles:
+  - Name: user
+    Allow:
+      - /user
+      - /order
+  - Name: "*"
+    Deny:
+      - /user
+      - /order
+Db_Log:
+  Driver: mysql
+  Host: 127.0.0.1
+  User: user
+  Password: password
+  Database: log
+Env:
+  auth: http://auth.io
+  browser: ie, chrome, firefox, safari
+  key: ""
+`
+	ktest.Equal(t, "YAML", expect, data)
+	ktest.Equal(t, "quote typed literal", "\"8000\"\n", string(node.MustChild("Listen").YAML(false)))
+
+	back, err := kson.ParseYAML([]byte(data))
+	if err != nil {
+		t.Error("ParseYAML error", err)
+		return
+	}
+	ktest.Equal(t, "round trip", string(node.JSON(false)), string(back.JSON(false)))
+}
+
+func TestParseYAML(t *testing.T) {
+	data := `---
+# comment
+name: 'it''s'   # comment
+list:
+- a
+- - b
+  - c
+-
+  k: v
+"quoted: key": "x # y"
+empty:
+hash: {}
+`
+	node, err := kson.ParseYAML([]byte(data))
+	if err != nil {
+		t.Error("ParseYAML error", err)
+		return
+	}
+	ktest.Equal(t, "json", `{"name":"it's","list":["a",["b","c"],{"k":"v"}],"quoted: key":"x # y","empty":"","hash":{}}`, string(node.JSON(false)))
+
+	node, err = kson.ParseYAML([]byte(`esc: "\e[0m|\N|\_|\L\P|\x41\xe9|\u00e9\U0001F600|\/|\"q\"|a\tb\	c|\ |\0"`))
+	if err != nil {
+		t.Error("ParseYAML escapes error", err)
+		return
+	}
+	ktest.Equal(t, "escapes", "\x1b[0m|\u0085|\u00a0|\u2028\u2029|A\u00e9|\u00e9\U0001F600|/|\"q\"|a\tb\tc| |\x00", node.ChildString("esc"))
+
+	for _, bad := range []string{"a: 1\n  b: 2", "a: [1, 2]", "a: 1\na: 2", "a: &x 1", "\ta: 1",
+		`a: "\q"`, `a: "\x4"`, `a: "\uD800"`, `a: "a"b"`, `a: "\"`} {
+		if _, err := kson.ParseYAML([]byte(bad)); err == nil {
+			t.Errorf("ParseYAML %q should fail", bad)
+		}
+	}
+}
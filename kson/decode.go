@@ -0,0 +1,211 @@
+// Copyright 2012 by sdm. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package kson
+
+import (
+	"fmt"
+	"github.com/sdming/kiss/gotype"
+	"reflect"
+	"runtime"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// MultiError is a list of errors, it's returned by strict decoding
+type MultiError []error
+
+func (m MultiError) Error() string {
+	switch len(m) {
+	case 0:
+		return "no error"
+	case 1:
+		return m[0].Error()
+	}
+
+	s := strconv.Itoa(len(m)) + " errors:"
+	for _, e := range m {
+		s += "\n\t" + e.Error()
+	}
+	return s
+}
+
+// Unwrap return the errors, so errors.Is and errors.As can check each of them
+func (m MultiError) Unwrap() []error {
+	return []error(m)
+}
+
+// decodeFrame is a node on the path from root to current node
+type decodeFrame struct {
+	key   string
+	index int // -1 if node is a hash item
+	node  *Node
+}
+
+// DecoderOptions controls how nodes are decoded to go values
+type DecoderOptions struct {
+	Strict bool // report problems as MultiError, see UnmarshalStrict
+	Infer  bool // literals decoded into interface{} are bool, int64, float64 or nil if they look like one, see Node.Interface
+
+	// AppendSlices appends items of lists to existing slices instead of replacing them,
+	// fields tagged with append or replace choose it for themselves.
+	AppendSlices bool
+
+	TimeLayouts []string // layouts of time.Time tried in order, gotype.TimeLayouts if empty
+
+	Limits // limits of data parsed by UnmarshalOptions and Decoder
+}
+
+// decodeState holds options and state of Node.Value
+type decodeState struct {
+	strict       bool
+	infer        bool
+	appendSlices bool
+	timeLayouts  []string
+	errs         []error
+	frames       []decodeFrame
+}
+
+// statePool keeps decodeStates, so a Value doesn't allocate its state
+var statePool = sync.Pool{
+	New: func() interface{} {
+		return &decodeState{frames: make([]decodeFrame, 0, 8)}
+	},
+}
+
+func newDecodeState(root *Node) *decodeState {
+	d := statePool.Get().(*decodeState)
+	d.frames = append(d.frames, decodeFrame{index: -1, node: root})
+	return d
+}
+
+// release clear d and put it back to pool, errors returned are not reused
+func (d *decodeState) release() {
+	frames := d.frames[:cap(d.frames)]
+	if len(frames) > 64 {
+		return
+	}
+	for i := range frames {
+		frames[i] = decodeFrame{}
+	}
+	*d = decodeState{frames: frames[:0]}
+	statePool.Put(d)
+}
+
+func (d *decodeState) enterKey(key string, n *Node) {
+	d.frames = append(d.frames, decodeFrame{key: key, index: -1, node: n})
+}
+
+func (d *decodeState) enterIndex(i int, n *Node) {
+	d.frames = append(d.frames, decodeFrame{index: i, node: n})
+}
+
+func (d *decodeState) exit() {
+	d.frames = d.frames[:len(d.frames)-1]
+}
+
+// path return path of current node, such as Roles[0].Allow
+func (d *decodeState) path() string {
+	s := ""
+	for _, f := range d.frames[1:] {
+		if f.index >= 0 {
+			s += "[" + strconv.Itoa(f.index) + "]"
+		} else {
+			s = appendPathKey(s, f.key)
+		}
+	}
+	return s
+}
+
+// errorf return a ValueError of current node
+func (d *decodeState) errorf(format string, a ...interface{}) *ValueError {
+	n := d.frames[len(d.frames)-1].node
+	return &ValueError{Pos: n.Pos, Path: d.path(), Err: fmt.Errorf(format, a...)}
+}
+
+// report record a problem of current node, it's ignored if decoding is not strict
+func (d *decodeState) report(format string, a ...interface{}) {
+	if d.strict {
+		d.errs = append(d.errs, d.errorf(format, a...))
+	}
+}
+
+// fail record an error of current node, it stops decoding if decoding is not strict
+func (d *decodeState) fail(err error) {
+	e := &ValueError{Pos: d.frames[len(d.frames)-1].node.Pos, Path: d.path(), Err: err}
+	if !d.strict {
+		panic(e)
+	}
+	d.errs = append(d.errs, e)
+}
+
+// mismatch report that node n can not be stored to v
+func (d *decodeState) mismatch(n *Node, v reflect.Value) {
+	if n.Type == NodeLiteral && n.Literal == "" {
+		return // empty value
+	}
+	d.report("can not unmarshal %s into %s", nameOfNodeType(n.Type), v.Type())
+}
+
+// parseLiteral set simple value v to literal of n, return false if literal can not be converted
+func (d *decodeState) parseLiteral(n *Node, v reflect.Value) bool {
+	var err error
+	if v.Type() == gotype.TypeTime {
+		var t time.Time
+		if t, err = gotype.ParseTime(n.Literal, d.timeLayouts...); err == nil {
+			v.Set(reflect.ValueOf(t))
+		}
+	} else {
+		err = gotype.Value(v).TryParse(n.Literal)
+	}
+	if err != nil && n.Literal != "" {
+		if e, ok := err.(*strconv.NumError); ok {
+			err = e.Err
+		}
+		d.report("literal %s for %s: %v", strconv.Quote(n.Literal), v.Type(), err)
+	}
+	return err == nil
+}
+
+// value unmarshal n to the value pointed to by a
+func (d *decodeState) value(n *Node, a interface{}) (err error) {
+
+	defer d.release()
+	defer func() {
+		if r := recover(); r != nil {
+			if _, ok := r.(runtime.Error); ok {
+				panic(r)
+			}
+			if e, ok := r.(*ValueError); ok {
+				err = e
+			} else {
+				err = d.errorf("%v", r)
+			}
+		}
+	}()
+
+	v := reflect.ValueOf(a)
+	if d.strict && (v.Kind() != reflect.Ptr || v.IsNil()) && v.Kind() != reflect.Map {
+		return &ValueError{Pos: n.Pos, Err: fmt.Errorf("unmarshal to non-pointer %T", a)}
+	}
+
+	n.set(d, v)
+	if len(d.errs) > 0 {
+		sort.Stable(byOffset(d.errs))
+		return MultiError(d.errs)
+	}
+	return
+}
+
+// byOffset sort ValueError by position
+type byOffset []error
+
+func (a byOffset) Len() int      { return len(a) }
+func (a byOffset) Swap(i, j int) { a[i], a[j] = a[j], a[i] }
+func (a byOffset) Less(i, j int) bool {
+	x, _ := a[i].(*ValueError)
+	y, _ := a[j].(*ValueError)
+	return x != nil && y != nil && x.Pos.Offset < y.Pos.Offset
+}
@@ -0,0 +1,547 @@
+// Copyright 2012 by sdm. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package kson_test
+
+import (
+	"fmt"
+	"github.com/sdming/kiss/kson"
+	"github.com/sdming/kiss/ktest"
+	"strings"
+	"testing"
+	"time"
+)
+
+type StrictConfig struct {
+	Port    int
+	Level   uint8
+	Enabled bool
+	Hosts   []string
+	Pair    [2]int
+	Db      Db
+	Env     map[string]int
+}
+
+var badStrictConfig = `
+{
+	Port:		80a
+	Level:		300
+	Enabled:	yes
+	Hosts:		localhost
+	Pair:	[
+		1
+		2
+		3
+	]
+	Db:	{
+		Host:	127.0.0.1
+		Hots:	typo
+	}
+	Env:	{
+		a:	1
+		b:	two
+	}
+	Unknown:	value
+}
+`
+
+func TestUnmarshalStrict(t *testing.T) {
+	var c StrictConfig
+	err := kson.UnmarshalStrict([]byte(badStrictConfig), &c)
+	if err == nil {
+		t.Error("strict unmarshal should fail")
+		return
+	}
+	t.Log(err)
+
+	errs, ok := err.(kson.MultiError)
+	if !ok {
+		t.Errorf("strict unmarshal should return MultiError, actual %T", err)
+		return
+	}
+
+	expect := []string{
+		`3:9: Port: literal "80a" for int: invalid syntax`,
+		`4:10: Level: literal "300" for uint8: value out of range`,
+		`5:11: Enabled: literal "yes" for bool: invalid syntax`,
+		`6:10: Hosts: can not unmarshal literal into []string`,
+		`7:8: Pair: list has 3 items, length of [2]int is 2`,
+		`14:9: Db.Hots: unknown key Hots of kson_test.Db`,
+		`18:6: Env.b: literal "two" for int: invalid syntax`,
+		`20:11: Unknown: unknown key Unknown of kson_test.StrictConfig`,
+	}
+	ktest.Equal(t, "count of errors", len(expect), len(errs))
+	for i, s := range expect {
+		if i < len(errs) && errs[i].Error() != s {
+			t.Errorf("error %d: expect %s; actual %s", i, s, errs[i])
+		}
+	}
+
+	ktest.Equal(t, "valid values are still set", "127.0.0.1", c.Db.Host)
+	ktest.Equal(t, "valid values of map are still set", 1, c.Env["a"])
+}
+
+func TestUnmarshalNotStrict(t *testing.T) {
+	var c StrictConfig
+	if err := kson.Unmarshal([]byte(badStrictConfig), &c); err != nil {
+		t.Error("unmarshal should ignore problems", err)
+	}
+	ktest.Equal(t, "Port", 0, c.Port)
+	ktest.Equal(t, "Db.Host", "127.0.0.1", c.Db.Host)
+}
+
+func TestDecoderStrict(t *testing.T) {
+	dec := kson.NewDecoder(strings.NewReader("{\n\tPort:\t8000\n}\n{\n\tPort:\t80a\n}\n"))
+	dec.Strict()
+
+	var c StrictConfig
+	if err := dec.Decode(&c); err != nil {
+		t.Error("decode 1 error", err)
+		return
+	}
+	ktest.Equal(t, "Port", 8000, c.Port)
+
+	err := dec.Decode(&c)
+	if err == nil || err.Error() != `5:8: Port: literal "80a" for int: invalid syntax` {
+		t.Errorf("decode 2 should report bad literal with position in stream, actual %v", err)
+	}
+}
+
+var interfaceData = `
+{
+	name:	kson
+	port:	8000
+	rate:	0.5
+	debug:	true
+	none:	null
+	hosts:	[
+		a
+		2
+	]
+	db:	{
+		host:	127.0.0.1
+	}
+}
+`
+
+func TestUnmarshalInterface(t *testing.T) {
+	var v interface{}
+	if err := kson.Unmarshal([]byte(interfaceData), &v); err != nil {
+		t.Error("unmarshal error", err)
+		return
+	}
+	m, ok := v.(map[string]interface{})
+	if !ok {
+		t.Errorf("hash should be map[string]interface{}, actual %T", v)
+		return
+	}
+	ktest.Equal(t, "string", "8000", m["port"])
+	ktest.Equal(t, "list", "[a 2]", fmt.Sprint(m["hosts"]))
+	ktest.Equal(t, "hash", "map[host:127.0.0.1]", fmt.Sprint(m["db"]))
+
+	v = nil
+	if err := kson.UnmarshalOptions([]byte(interfaceData), &v, kson.DecoderOptions{Infer: true}); err != nil {
+		t.Error("unmarshal infer error", err)
+		return
+	}
+	m = v.(map[string]interface{})
+	ktest.Equal(t, "name", "kson", m["name"])
+	ktest.Equal(t, "int64", int64(8000), m["port"])
+	ktest.Equal(t, "float64", 0.5, m["rate"])
+	ktest.Equal(t, "bool", true, m["debug"])
+	ktest.Equal(t, "null", true, m["none"] == nil)
+	ktest.Equal(t, "list", int64(2), m["hosts"].([]interface{})[1])
+
+	var c struct {
+		Port interface{}
+		Db   interface{}
+	}
+	c.Db = &Db{}
+	if err := kson.UnmarshalOptions([]byte(interfaceData), &c, kson.DecoderOptions{Infer: true}); err != nil {
+		t.Error("unmarshal struct error", err)
+		return
+	}
+	ktest.Equal(t, "field", int64(8000), c.Port)
+	ktest.Equal(t, "pointer in interface", "127.0.0.1", c.Db.(*Db).Host)
+}
+
+func TestDecoderInfer(t *testing.T) {
+	dec := kson.NewDecoder(strings.NewReader("[\n\t1\n\ttrue\n]\n"))
+	dec.Infer()
+
+	var v interface{}
+	if err := dec.Decode(&v); err != nil {
+		t.Error("decode error", err)
+		return
+	}
+	ktest.Equal(t, "list", "[1 true]", fmt.Sprint(v))
+	ktest.Equal(t, "bool", true, v.([]interface{})[1])
+}
+
+type Backend struct {
+	Host   string
+	Weight int
+}
+
+type HostName string
+
+type MapKeys struct {
+	Backends map[int]*Backend
+	Ports    map[uint16]string
+	Flags    map[bool]string
+	Hosts    map[HostName]Backend
+	Levels   map[Level]int
+}
+
+func TestMapKeys(t *testing.T) {
+	data := MapKeys{
+		Backends: map[int]*Backend{10: {"a", 1}, 9: {"b", 2}, -1: {"c", 3}},
+		Ports:    map[uint16]string{8080: "http", 443: "https"},
+		Flags:    map[bool]string{true: "on", false: "off"},
+		Hosts:    map[HostName]Backend{"db": {"10.0.0.1", 5}},
+		Levels:   map[Level]int{LevelInfo: 1, LevelError: 2},
+	}
+
+	b, err := kson.MarshalIndent(data, "\t")
+	if err != nil {
+		t.Error("marshal error", err)
+		return
+	}
+	s := string(b)
+	if !strings.Contains(s, "Backends:{\n\t\t-1:{") || strings.Index(s, "\t\t9:{") > strings.Index(s, "\t\t10:{") {
+		t.Error("int keys should be sorted by value", s)
+	}
+	if !strings.Contains(s, "\t\terror:2\n") {
+		t.Error("key should be formatted by MarshalText", s)
+	}
+
+	var p MapKeys
+	if err := kson.UnmarshalStrict(b, &p); err != nil {
+		t.Error("unmarshal error", err, s)
+		return
+	}
+	ktest.Equal(t, "int key", "b", p.Backends[9].Host)
+	ktest.Equal(t, "negative key", 3, p.Backends[-1].Weight)
+	ktest.Equal(t, "uint16 key", "https", p.Ports[443])
+	ktest.Equal(t, "bool key", "off", p.Flags[false])
+	ktest.Equal(t, "named string key", "10.0.0.1", p.Hosts["db"].Host)
+	ktest.Equal(t, "TextUnmarshaler key", 2, p.Levels[LevelError])
+
+	err = kson.UnmarshalStrict([]byte("{\n\tPorts:\t{\n\t\t70000:\tx\n\t}\n\tFlags:\t{\n\t\tyes:\tx\n\t}\n}\n"), &p)
+	if err == nil || !strings.Contains(err.Error(), `key "70000" for uint16`) || !strings.Contains(err.Error(), `key "yes" for bool`) {
+		t.Error("bad keys should be reported", err)
+	}
+}
+
+type Optional struct {
+	Backend *Backend
+	Hosts   []string
+	Env     map[string]string
+	Name    string
+	Empty   string
+}
+
+func TestNull(t *testing.T) {
+	node, err := kson.Parse([]byte("{\n\tnull:\tnull\n\tempty:\n\tquoted:\t\"null\"\n}\n"))
+	if err != nil {
+		t.Error("parse error", err)
+		return
+	}
+	ktest.Equal(t, "null", true, node.MustChild("null").IsNull())
+	ktest.Equal(t, "empty", false, node.MustChild("empty").IsNull())
+	ktest.Equal(t, "empty", "", node.ChildString("empty"))
+	ktest.Equal(t, "quoted", "null", node.ChildString("quoted"))
+	if _, ok := node.Child("missing"); ok {
+		t.Error("missing child should not exist")
+	}
+
+	b, err := kson.Marshal(Optional{Hosts: []string{}, Name: "null"})
+	if err != nil {
+		t.Error("marshal error", err)
+		return
+	}
+	ktest.Equal(t, "marshal", "{\n\tBackend:null\n\tHosts:[\n\t]\n\n\tEnv:null\n\tName:\"null\"\n\tEmpty:\"\"\n}\n", string(b))
+
+	p := Optional{Backend: &Backend{Host: "a"}, Env: map[string]string{"a": "b"}, Empty: "x"}
+	if err = kson.UnmarshalStrict(b, &p); err != nil {
+		t.Error("unmarshal error", err)
+		return
+	}
+	ktest.Equal(t, "nil pointer", true, p.Backend == nil)
+	ktest.Equal(t, "nil map", true, p.Env == nil)
+	ktest.Equal(t, "empty slice", true, p.Hosts != nil && len(p.Hosts) == 0)
+	ktest.Equal(t, "string", "null", p.Name)
+	ktest.Equal(t, "empty string", "", p.Empty)
+
+	p.Name = "keep"
+	if err = kson.Unmarshal([]byte("{\n\tName:\tnull\n}\n"), &p); err != nil {
+		t.Error("unmarshal error", err)
+		return
+	}
+	ktest.Equal(t, "null to string", "keep", p.Name)
+}
+
+type Timeouts struct {
+	Timeout  time.Duration
+	Date     time.Time
+	Start    *time.Time
+	Retry    map[string]time.Duration
+	Deadline time.Time
+}
+
+func TestTime(t *testing.T) {
+	data := "{\n\tTimeout:\t30s\n\tDate:\t2012-12-21\n\tStart:\t2012-12-21T08:30:00+08:00\n\tRetry:\t{\n\t\tdb:\t1m30s\n\t}\n}\n"
+
+	var p Timeouts
+	if err := kson.UnmarshalStrict([]byte(data), &p); err != nil {
+		t.Error("unmarshal error", err)
+		return
+	}
+	ktest.Equal(t, "duration", 30*time.Second, p.Timeout)
+	ktest.Equal(t, "date", "2012-12-21 00:00:00 +0000 UTC", p.Date.String())
+	ktest.Equal(t, "pointer", 8, p.Start.Hour())
+	ktest.Equal(t, "map", 90*time.Second, p.Retry["db"])
+	ktest.Equal(t, "empty", true, p.Deadline.IsZero())
+
+	b, err := kson.MarshalOptions(p, kson.EncoderOptions{TimeLayout: "2006-01-02"})
+	if err != nil {
+		t.Error("marshal error", err)
+		return
+	}
+	s := string(b)
+	for _, x := range []string{"Timeout:30s", "Date:2012-12-21\n", "Start:2012-12-21\n", "db:1m30s"} {
+		if !strings.Contains(s, x) {
+			t.Errorf("marshal should contain %s: %s", x, s)
+		}
+	}
+
+	b, _ = kson.Marshal(p)
+	var back Timeouts
+	if err = kson.Unmarshal(b, &back); err != nil {
+		t.Error("unmarshal error", err)
+		return
+	}
+	ktest.Equal(t, "round trip", true, back.Start.Equal(*p.Start) && back.Timeout == p.Timeout)
+
+	opts := kson.DecoderOptions{Strict: true, TimeLayouts: []string{"02/01/2006"}}
+	if err = kson.UnmarshalOptions([]byte("{\n\tDate:\t21/12/2012\n}\n"), &p, opts); err != nil {
+		t.Error("unmarshal layouts error", err)
+	}
+	ktest.Equal(t, "layouts", 21, p.Date.Day())
+
+	err = kson.UnmarshalStrict([]byte("{\n\tTimeout:\t30x\n\tDate:\t2012/12/21\n}\n"), &p)
+	if err == nil || !strings.Contains(err.Error(), "Timeout: literal") || !strings.Contains(err.Error(), "Date: literal") {
+		t.Error("bad duration and time should be reported", err)
+	}
+}
+
+func TestParseNodes(t *testing.T) {
+	data := []byte("{\n\tA:\t[\n\t\ta1\n\t\ta2\n\t]\n\tB:\t[\n\t\tb1\n\t]\n\tC:\t\"c\\\n\t\tc\"\n\tD:\n}\n")
+	node, err := kson.Parse(data)
+	if err != nil {
+		t.Error("parse error", err)
+		return
+	}
+
+	// literals don't share bytes with input
+	copy(data, strings.Repeat("x", len(data)))
+	ktest.Equal(t, "A[1]", "a2", node.MustChild("A").List[1].Literal)
+	ktest.Equal(t, "C", "cc", node.ChildString("C"))
+	ktest.Equal(t, "D", kson.NodeLiteral, node.MustChild("D").Type)
+	ktest.Equal(t, "keys", "[A B C D]", fmtKeys(node.Keys))
+
+	// appending to a list or keys doesn't overwrite others
+	a := node.MustChild("A")
+	a.List = append(a.List, &kson.Node{Type: kson.NodeLiteral, Literal: "a3"})
+	node.Keys = append(node.Keys, "E")
+	ktest.Equal(t, "B[0]", "b1", node.MustChild("B").List[0].Literal)
+	ktest.Equal(t, "A[2]", "a3", a.List[2].Literal)
+
+	// parses in goroutines share pooled stacks
+	done := make(chan string)
+	for i := 0; i < 8; i++ {
+		go func(i int) {
+			n, err := kson.Parse([]byte(fmt.Sprintf("[\n\t%d\n\t{\n\t\tk:\t%d\n\t}\n]\n", i, i)))
+			if err != nil {
+				done <- err.Error()
+				return
+			}
+			done <- n.List[0].Literal + " " + n.List[1].ChildString("k")
+		}(i)
+	}
+	for i := 0; i < 8; i++ {
+		s := <-done
+		ktest.Equal(t, "goroutine", s[:len(s)/2], s[len(s)/2+1:])
+	}
+}
+
+func TestParseQuotedKeys(t *testing.T) {
+	data := "{\n\t\"a: b\":\t1\n\t`\"x\"` :\t2\n\t<<EOT\nmulti\nline\n\tEOT:\t3\n\tInline:\t{\"c,d\": 4, `}`: 5}\n}\n"
+	node, err := kson.Parse([]byte(data))
+	if err != nil {
+		t.Error("parse error", err)
+		return
+	}
+	ktest.Equal(t, "keys", "[a: b \"x\" multi\nline Inline]", fmtKeys(node.Keys))
+	ktest.Equal(t, "heredoc key", "3", node.ChildString("multi\nline"))
+	ktest.Equal(t, "inline keys", "[c,d }]", fmtKeys(node.MustChild("Inline").Keys))
+
+	if _, err = kson.Parse([]byte("{\n\t\"a\" b:\t1\n}\n")); err == nil {
+		t.Error("text after quoted key should fail")
+	}
+}
+
+func TestParseInline(t *testing.T) {
+	data := "Browser:\t[ie, chrome , firefox]\n" +
+		"Empty:\t[]\n" +
+		"Quoted:\t[\"a, b\", `say \"hi\"`, \"]\", null, \"null\"]\n" +
+		"Db:\t{Host: 127.0.0.1, Port: 3306, Tags: [master, {zone: a}]}\n" +
+		"Roles:\t[\n\t{Name: admin, Allow: [/admin]}\n\t[]\n]\n"
+	doc, err := kson.ParseDocument([]byte(data))
+	if err != nil {
+		t.Error("parse error", err)
+		return
+	}
+	node := doc.Root()
+
+	browser, _ := node.MustChild("Browser").Slice()
+	ktest.Equal(t, "browser", "ie|chrome|firefox", strings.Join(browser, "|"))
+	ktest.Equal(t, "empty", 0, len(node.MustChild("Empty").List))
+
+	quoted := node.MustChild("Quoted").List
+	ktest.Equal(t, "quoted comma", "a, b", quoted[0].Literal)
+	ktest.Equal(t, "back quote", `say "hi"`, quoted[1].Literal)
+	ktest.Equal(t, "quoted ]", "]", quoted[2].Literal)
+	ktest.Equal(t, "null", kson.NodeNull, quoted[3].Type)
+	ktest.Equal(t, "quoted null", kson.NodeLiteral, quoted[4].Type)
+
+	db := node.MustChild("Db")
+	ktest.Equal(t, "db keys", "[Host Port Tags]", fmtKeys(db.Keys))
+	ktest.Equal(t, "db port", "3306", db.ChildString("Port"))
+	zone, _ := node.QueryString("Db.Tags[1].zone")
+	ktest.Equal(t, "zone", "a", zone)
+	ktest.Equal(t, "db pos", 5, db.Pos.Column)
+	ktest.Equal(t, "zone pos", len("Db:\t{Host: 127.0.0.1, Port: 3306, Tags: [master, {zone: ")+1, db.MustChild("Tags").List[1].MustChild("zone").Pos.Column)
+
+	allow, _ := node.QueryString("Roles[0].Allow[0]")
+	ktest.Equal(t, "allow", "/admin", allow)
+	ktest.Equal(t, "roles[1]", kson.NodeList, node.MustChild("Roles").List[1].Type)
+
+	var c struct {
+		Browser []string
+		Db      map[string]interface{}
+	}
+	if err := kson.Unmarshal([]byte("{\n\tBrowser:\t[ie, chrome]\n\tDb:\t{Port: 3306}\n}\n"), &c); err != nil {
+		t.Error("unmarshal error", err)
+	}
+	ktest.Equal(t, "unmarshal browser", 2, len(c.Browser))
+	ktest.Equal(t, "unmarshal db", "3306", c.Db["Port"])
+
+	bad := map[string]string{
+		"A:\t[a, b\n":        "1:4: inline list is not closed",
+		"A:\t[a, , b]\n":     "1:8: item of inline list or hash is empty",
+		"A:\t[a, b] c\n":     "1:11: unexpected c after inline [",
+		"A:\t{a: 1, b}\n":    "1:11: inline hash format error",
+		"A:\t[\"a, b]\n":     "1:5: quote format error",
+		"A:\t{a: [1, 2}\n":   "1:13: unexpected } in inline list",
+		"A:\t[a, b]]\n":      "1:10: unexpected ] after inline [",
+		"A:\t[[a], [b] x]\n": "1:14: unexpected x in inline list",
+	}
+	for s, expect := range bad {
+		_, err := kson.ParseDocument([]byte(s))
+		if err == nil {
+			t.Errorf("parse %q should fail", s)
+			continue
+		}
+		ktest.Equal(t, fmt.Sprintf("parse %q", s), expect, err.Error())
+	}
+}
+
+type Layered struct {
+	Name    string
+	Hosts   []string
+	Tags    []string `kson:",append"`
+	Only    []string `kson:",replace"`
+	Db      Db
+	Log     *Db
+	Limits  map[string]int
+	Servers map[string]Db
+	Extra   map[string]interface{}
+}
+
+func layeredDefaults() Layered {
+	return Layered{
+		Name:    "app",
+		Hosts:   append(make([]string, 0, 4), "a", "b"),
+		Tags:    []string{"t1"},
+		Only:    []string{"o1"},
+		Db:      Db{Host: "localhost", User: "root"},
+		Log:     &Db{Host: "logs", Database: "log"},
+		Limits:  map[string]int{"a": 1},
+		Servers: map[string]Db{"web": {Host: "web.local", User: "www"}},
+		Extra:   map[string]interface{}{"a": map[string]interface{}{"x": "1"}},
+	}
+}
+
+var layeredData = `{
+	Hosts:	[
+		c
+	]
+	Tags:	[
+		t2
+	]
+	Only:	[
+		o2
+	]
+	Db:	{
+		Host:	db.local
+	}
+	Log:	{
+		User:	logger
+	}
+	Limits:	{
+		b:	2
+	}
+	Servers:	{
+		web:	{
+			Host:	web.io
+		}
+	}
+	Extra:	{
+		a:	{
+			y:	2
+		}
+	}
+}`
+
+func TestUnmarshalDefaults(t *testing.T) {
+	defaults := layeredDefaults()
+	c := defaults
+	if err := kson.UnmarshalStrict([]byte(layeredData), &c); err != nil {
+		t.Error("unmarshal error", err)
+		return
+	}
+
+	ktest.Equal(t, "Name", "app", c.Name)
+	ktest.Equal(t, "Hosts", "[c]", fmtKeys(c.Hosts))
+	ktest.Equal(t, "Tags", "[t1 t2]", fmtKeys(c.Tags))
+	ktest.Equal(t, "Only", "[o2]", fmtKeys(c.Only))
+	ktest.Equal(t, "Db.Host", "db.local", c.Db.Host)
+	ktest.Equal(t, "Db.User", "root", c.Db.User)
+	ktest.Equal(t, "Log", "logs logger log", c.Log.Host+" "+c.Log.User+" "+c.Log.Database)
+	ktest.Equal(t, "Limits", "1 2", fmt.Sprint(c.Limits["a"], c.Limits["b"]))
+	ktest.Equal(t, "Servers", "web.io www", c.Servers["web"].Host+" "+c.Servers["web"].User)
+	ktest.Equal(t, "Extra", "map[x:1 y:2]", fmt.Sprint(c.Extra["a"]))
+	ktest.Equal(t, "Db of defaults", "localhost", defaults.Db.Host)
+	ktest.Equal(t, "Hosts of defaults", "[a b]", fmtKeys(defaults.Hosts))
+
+	c = layeredDefaults()
+	opts := kson.DecoderOptions{Strict: true, AppendSlices: true}
+	if err := kson.UnmarshalOptions([]byte(layeredData), &c, opts); err != nil {
+		t.Error("unmarshal append error", err)
+		return
+	}
+	ktest.Equal(t, "append Hosts", "[a b c]", fmtKeys(c.Hosts))
+	ktest.Equal(t, "append Tags", "[t1 t2]", fmtKeys(c.Tags))
+	ktest.Equal(t, "append Only", "[o2]", fmtKeys(c.Only))
+}
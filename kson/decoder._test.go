@@ -6,6 +6,9 @@ package kson_test
 import (
 	"github.com/sdming/kiss/kson"
 	"github.com/sdming/kiss/ktest"
+	"io/ioutil"
+	"os"
+	"path/filepath"
 	"reflect"
 	"testing"
 )
@@ -339,6 +342,88 @@ func TestUnmarshalStruct(t *testing.T) {
 
 }
 
+func TestParseErrorPosition(t *testing.T) {
+	cases := []struct {
+		data   string
+		line   int
+		column int
+	}{
+		{"{\n\tname: value\n\tbad line\n}\n", 3, 2},
+		{"{\n\tlist: [ a\n}\n", 2, 8},
+		{"{\n\tquote: \"abc\n}\n", 2, 9},
+		{"[\n\ta\n}\n", 3, 1},
+		{"{\n\tname: value\n", 1, 1},
+	}
+
+	for _, c := range cases {
+		_, err := kson.Parse([]byte(c.data))
+		if err == nil {
+			t.Errorf("parse %q should fail", c.data)
+			continue
+		}
+		fe, ok := err.(*kson.FormatError)
+		if !ok {
+			t.Errorf("parse %q error should be FormatError, actual %T", c.data, err)
+			continue
+		}
+		if fe.Pos.Line != c.line || fe.Pos.Column != c.column {
+			t.Errorf("parse %q error position: expect %d:%d; actual %s", c.data, c.line, c.column, fe.Pos)
+		}
+	}
+}
+
+func TestNodePosition(t *testing.T) {
+	data := "{\n\tname:\tvalue\n\tlist: [\n\t\tone\n\t]\n\tempty:\n}\n"
+	n, err := kson.Parse([]byte(data))
+	if err != nil {
+		t.Error("parse error", err)
+		return
+	}
+
+	ktest.Equal(t, "root", "1:1", n.Pos.String())
+	ktest.Equal(t, "name", "2:8", n.MustChild("name").Pos.String())
+	ktest.Equal(t, "list", "3:8", n.MustChild("list").Pos.String())
+	ktest.Equal(t, "list item", "4:3", n.MustChild("list").List[0].Pos.String())
+	ktest.Equal(t, "empty", "6:8", n.MustChild("empty").Pos.String())
+
+	_, err = n.MustChild("list").Int()
+	if e, ok := err.(*kson.InvalidNodeTypeError); !ok || e.Pos.Line != 3 {
+		t.Errorf("Int of list should return InvalidNodeTypeError at line 3, actual %v", err)
+	}
+}
+
+func TestParseFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "app.kson")
+	data := "# comments\nname:\tvalue\n\n# more comments\nlist: [\n\t# comment of list\n\tone\n]\n"
+	if err = ioutil.WriteFile(filename, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := kson.ParseFile(filename)
+	if err != nil {
+		t.Error("parse file error", err)
+		return
+	}
+	ktest.Equal(t, "name", "value", n.ChildString("name"))
+	ktest.Equal(t, "list", 1, len(n.MustChild("list").List))
+	ktest.Equal(t, "name pos", filename+":2:7", n.MustChild("name").Pos.String())
+
+	data = "name:\tvalue\nbad line\n"
+	if err = ioutil.WriteFile(filename, []byte(data), 0644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = kson.ParseFile(filename)
+	if err == nil || err.Error() != filename+":2:1: hash format error" {
+		t.Errorf("parse file error should contain filename and position, actual %v", err)
+	}
+}
+
 // func performance() {
 
 // 	t := newConfig()
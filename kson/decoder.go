@@ -5,8 +5,15 @@ package kson
 
 import (
 	"bytes"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode/utf8"
 )
 
+// errShort means data ends in the middle of a value, need to read more
+var errShort = errors.New("kson: data is too short")
+
 const (
 	stateNone = iota
 	stateList
@@ -31,92 +38,201 @@ func stateName(state int) string {
 	panic("error state " + stateName(state))
 }
 
-type nodestack struct {
-	parent *nodestack
-	name   []byte
-	state  int
-	node   *Node
-}
+type decoder struct {
+	data   []byte
+	src    string // data as string, literals and keys are substrings of it
+	off    int
+	length int
 
-func newNodestack() *nodestack {
-	return &nodestack{node: &Node{}}
-}
+	*parseStack
+	slab    slab
+	nesting int // count of open lists and hashes
 
-func (stack *nodestack) enter(state int) *nodestack {
-	//fmt.Println("nodestack enter", stateName(state))
+	limits Limits
+	ends   map[*Node]int // offsets where nodes end, exclusive, they are only kept for Document
 
-	var node *Node
-	switch state {
-	case stateList:
-		node = &Node{Type: NodeList, List: make([]*Node, 0, capacity)}
-	case stateHash:
-		node = &Node{Type: NodeHash, Hash: make(map[string]*Node, capacity)}
-	case stateHashItem:
-		node = &Node{}
-	case stateListItem:
-		node = &Node{}
-	}
-	return &nodestack{parent: stack, state: state, node: node}
+	filename string
+	comments bool // skip lines start with #
+	implicit bool // data is content of a hash without { and }
+	one      bool // stop after the first top level value
+	more     bool // more data may follow, return errShort if a value is not finished
+
+	// position of data[0] in the whole stream
+	offBase  int
+	lineBase int
+
+	// line cache of pos()
+	line      int
+	lineStart int
+	lineOff   int
 }
 
-func (stack *nodestack) exit(state int) *nodestack {
-	//fmt.Println("nodestack exit", stateName(state), "parent", stateName(stack.parent.state))
+func newDecoder(data []byte) *decoder {
+	return &decoder{data: data, length: len(data), line: 1}
+}
 
-	if stack.state != state {
-		panic("node stack exit state does not match " + stateName(state))
+// seek move line cache to offset off, return off or the end of data if it's after the end
+func (d *decoder) seek(off int) int {
+	if off > d.length {
+		off = d.length
 	}
-
-	if (state == stateListItem || state == stateHashItem) && stack.node.Type == NodeNone {
-		stack.node.Type = NodeLiteral
-		//stack.node.Literal = []byte{}
+	if off < d.lineOff {
+		d.line, d.lineStart, d.lineOff = 1, 0, 0
+	}
+	for i := d.lineOff; i < off; i++ {
+		if d.data[i] == '\n' {
+			d.line++
+			d.lineStart = i + 1
+		}
 	}
+	d.lineOff = off
+	return off
+}
 
-	if state == stateListItem && stack.parent.state == stateList {
-		stack.parent.node.List = append(stack.parent.node.List, stack.node)
-	} else if state == stateHashItem && stack.parent.state == stateHash {
-		stack.parent.node.Hash[string(stack.name)] = stack.node
-	} else if stack.parent.state == stateNone {
-		stack.parent.node = stack.node
-	} else if stack.parent.state == stateListItem || stack.parent.state == stateHashItem {
-		stack.parent.node = stack.node
-	} else {
+// pos return position of offset off
+func (d *decoder) pos(off int) Position {
+	off = d.seek(off)
+	return Position{
+		Filename: d.filename,
+		Offset:   d.offBase + off,
+		Line:     d.lineBase + d.line,
+		Column:   off - d.lineStart + 1,
+	}
+}
 
+// setPos set position of node starts at off, filename is only set if it's known
+func (d *decoder) setPos(node *Node, off int) {
+	off = d.seek(off)
+	node.Pos.Offset, node.Pos.Line, node.Pos.Column = d.offBase+off, d.lineBase+d.line, off-d.lineStart+1
+	if d.filename != "" {
+		node.Pos.Filename = d.filename
 	}
+}
 
-	return stack.parent
+func (d *decoder) error(off int, msg string) *FormatError {
+	return &FormatError{Message: msg, Pos: d.pos(off)}
 }
 
-type decoder struct {
-	data   []byte
-	off    int
-	length int
-	//buff  bytes.Buffer
+// top return the innermost frame
+func (d *decoder) top() *frame {
+	return &d.frames[len(d.frames)-1]
+}
+
+// depth return count of open lists, hashes and items
+func (d *decoder) depth() int {
+	return len(d.frames) - 1
+}
 
-	states   [16]int
-	stateOff uint
+func (d *decoder) state() int {
+	return d.top().state
 }
 
-func (d *decoder) enterState(state int) int {
-	d.stateOff++
-	d.states[d.stateOff] = state
+// enter push a frame of state, lists and hashes start at off, items start at d.off
+func (d *decoder) enter(state int, off int) int {
+	var node *Node
+	if state == stateList || state == stateHash {
+		node = d.slab.node()
+		d.setPos(node, off)
+		d.nesting++
+	}
+	// fields are set one by one, it's cheaper than copying a frame
+	n := len(d.frames)
+	if n < cap(d.frames) {
+		d.frames = d.frames[:n+1]
+	} else {
+		d.frames = append(d.frames, frame{})
+	}
+	f := &d.frames[n]
+	f.state, f.off, f.items, f.name, f.node = state, d.off, len(d.items), span{}, node
+	if n >= d.maxFrames {
+		d.maxFrames = n + 1
+	}
 	return state
 }
 
-func (d *decoder) state() int {
-	return d.states[d.stateOff]
+// exit pop the frame of state, add its node to the parent, return state of parent
+func (d *decoder) exit(state int) int {
+	f := d.top()
+	if f.state != state || len(d.frames) < 2 {
+		panic("decoder exit state does not match " + stateName(state))
+	}
+
+	node := f.node
+	switch state {
+	case stateListItem, stateHashItem:
+		if node == nil {
+			node = d.slab.node()
+			node.Type = NodeLiteral
+			d.setPos(node, f.off)
+			d.setEnd(node, f.off)
+		}
+	case stateList, stateHash:
+		d.collect(node, state, f.items)
+	}
+	name := f.name
+	d.frames = d.frames[:len(d.frames)-1]
+
+	parent := d.top()
+	if state == stateListItem && parent.state == stateList {
+		d.items = append(d.items, item{node: node})
+	} else if state == stateHashItem && parent.state == stateHash {
+		d.items = append(d.items, item{name, node})
+	} else {
+		parent.node = node
+	}
+	return parent.state
+}
+
+// str return substring of source of sp
+func (d *decoder) str(sp span) string {
+	return d.src[sp.start:sp.end]
+}
+
+// trimSpan return span of source from start to end without spaces at both ends
+func (d *decoder) trimSpan(start, end int) span {
+	for start < end && isSpace(d.data[start]) {
+		start++
+	}
+	for end > start && isSpace(d.data[end-1]) {
+		end--
+	}
+	if start < end && (d.data[start] >= utf8.RuneSelf || d.data[end-1] >= utf8.RuneSelf) {
+		s := d.src[start:end] // unicode spaces
+		t := strings.TrimSpace(s)
+		start += strings.Index(s, t)
+		end = start + len(t)
+	}
+	return span{start, end}
 }
 
-func (d *decoder) exitState(state int) int {
-	if d.state() != state {
-		panic("decoder state does not match " + stateName(state))
+// setEnd record node ends at off if ends are kept
+func (d *decoder) setEnd(node *Node, off int) {
+	if d.ends != nil {
+		d.ends[node] = off
 	}
+}
 
-	if d.stateOff > 0 {
-		d.stateOff--
-		return d.state()
+// collect set items from base of stack as items of list or hash node, and pop them
+func (d *decoder) collect(node *Node, state int, base int) {
+	d.nesting--
+	if len(d.items) > d.maxItems {
+		d.maxItems = len(d.items)
+	}
+	if state == stateList {
+		node.Type = NodeList
+		node.List = d.slab.list(d.items[base:])
+	} else {
+		node.Type = NodeHash
+		node.Hash = make(map[string]*Node, len(d.items)-base)
+		node.Keys = d.slab.strings(len(d.items) - base)
+		for _, x := range d.items[base:] {
+			name, n := d.str(x.name), len(node.Hash)
+			if node.Hash[name] = x.node; len(node.Hash) > n {
+				node.Keys = append(node.Keys, name)
+			}
+		}
 	}
-	panic("decoder exit state error " + stateName(state))
-	return stateNone
+	d.items = d.items[:base]
 }
 
 func (d *decoder) readByte() byte {
@@ -145,15 +261,14 @@ func (d *decoder) readBytes(delim byte) (end int, ok bool) {
 }
 
 func (d *decoder) readBytesofLine(delim byte) (end int, ok bool) {
-	i := bytes.IndexAny(d.data[d.off:], string([]byte{delim, '\n'}))
-	if i < 0 {
-		d.off = d.length
-		return d.off - 1, false
+	for i := d.off; i < d.length; i++ {
+		if c := d.data[i]; c == delim || c == '\n' {
+			d.off = i + 1
+			return i, c == delim
+		}
 	}
-	end = d.off + i
-	ok = d.data[end] == delim
-	d.off = end + 1
-	return
+	d.off = d.length
+	return d.off - 1, false
 }
 
 func (d *decoder) endofLine() bool {
@@ -175,14 +290,44 @@ func (d *decoder) endofLine() bool {
 	return true
 }
 
+// Position describes a location in kson source
+type Position struct {
+	Filename string
+	Offset   int // byte offset, start at 0
+	Line     int // line number, start at 1
+	Column   int // column number, start at 1 (byte count)
+}
+
+// IsValid return true if the position is known
+func (p Position) IsValid() bool {
+	return p.Line > 0
+}
+
+// String return position as file:line:col
+func (p Position) String() string {
+	s := p.Filename
+	if p.IsValid() {
+		if s != "" {
+			s += ":"
+		}
+		s += fmt.Sprintf("%d:%d", p.Line, p.Column)
+	}
+	if s == "" {
+		s = "-"
+	}
+	return s
+}
+
+// FormatError describes a syntax error of kson source
 type FormatError struct {
 	Message string
-	// column   int
-	// row      int
-	// position int
+	Pos     Position
 }
 
 func (e *FormatError) Error() string {
+	if e.Pos.IsValid() {
+		return e.Pos.String() + ": " + e.Message
+	}
 	return e.Message
 }
 
@@ -202,91 +347,449 @@ func isSpace(c byte) bool {
 	return false
 }
 
+// Parse parse data to node
 func Parse(data []byte) (node *Node, err error) {
 	if data == nil || len(data) == 0 {
-		err = &FormatError{"data to parse is emty"}
+		err = &FormatError{Message: "data to parse is emty"}
 		return
 	}
+	return newDecoder(data).parse()
+}
 
-	dec := &decoder{data: data, length: len(data)}
-	state, stack := dec.state(), newNodestack()
+// parse parse data, nodes are allocated in slabs, literals and keys are substrings of one copy of data
+func (dec *decoder) parse() (node *Node, err error) {
+	if err = dec.checkBytes(); err != nil {
+		return
+	}
+	dec.src = string(dec.data)
+	// about 3 of 4 lines are values, others are ], } or blank
+	dec.slab = newSlab(bytes.Count(dec.data, []byte{'\n'})*3/4 + 1)
+	dec.parseStack = stackPool.Get().(*parseStack)
+	defer func() {
+		dec.parseStack.release()
+		dec.parseStack = nil
+	}()
+
+	dec.frames = append(dec.frames, frame{state: stateNone})
+	state := stateNone
+	if dec.implicit {
+		state = dec.enter(stateHash, 0)
+	}
 
+	off := 0
 	for {
-		off := dec.off
+		// nodes of the last token are counted
+		if err = dec.checkRead(off); err != nil {
+			return nil, err
+		}
+		dec.skipSpaces()
+		off = dec.off
 		c := dec.readByte()
-		//fmt.Printf("read state=[%s], off=[%v]; c=[%v],  %c \n", stateName(state), off, c, c)
 
-		if c == eof || c == '\n' { // || c == '\r'
-			if state == stateListItem || state == stateHashItem { // 
-				state, stack = dec.exitState(state), stack.exit(state)
+		if c == eof || c == '\n' {
+			if state == stateListItem || state == stateHashItem {
+				state = dec.exit(state)
 			}
 		}
 		if c == eof {
+			if dec.more {
+				return nil, errShort
+			}
 			break
 		} else if isSpace(c) {
 			continue
 		}
 
+		if c == '#' && dec.comments && (state == stateHash || state == stateList || state == stateNone) {
+			dec.readLine()
+			continue
+		}
+
 		if state == stateHash && c != '}' {
-			i, ok := dec.readBytesofLine(':')
-			if !ok || off == i {
-				err = &FormatError{"hash format error"}
+			var name span
+			if name, err = dec.readKey(c, off); err != nil {
 				return
 			}
-			//fmt.Printf("name:[%s]\n", string(bytes.TrimSpace(dec.data[off:i])))
-			state, stack = dec.enterState(stateHashItem), stack.enter(stateHashItem)
-			stack.name = bytes.TrimSpace(dec.data[off:i])
+			state = dec.enter(stateHashItem, off)
+			dec.top().name = name
 			continue
 		} else if state == stateList && c != ']' {
-			state, stack = dec.enterState(stateListItem), stack.enter(stateListItem)
+			state = dec.enter(stateListItem, off)
 		}
 
-		if isContainerDelim(c) {
+		if (c == '[' || c == '{') && !dec.endofLine() {
+			// a list or hash on one line, such as [a, b] and {k: v}
+			dec.off = off
+			var n *Node
+			if n, err = dec.readInline(); err != nil {
+				return
+			}
 			if !dec.endofLine() {
-				err = &FormatError{string(c) + " is not end of line"}
+				err = dec.error(dec.off-1, "unexpected "+string(dec.data[dec.off-1])+" after inline "+string(c))
 				return
 			}
+			dec.top().node = n
+		} else if isContainerDelim(c) {
+			if !dec.endofLine() {
+				err = dec.error(off, string(c)+" is not end of line")
+				return
+			}
+			if c == '[' || c == '{' {
+				if err = dec.checkDepth(off); err != nil {
+					return
+				}
+			}
 			switch c {
 			case '[':
-				state, stack = dec.enterState(stateList), stack.enter(stateList)
-			case ']':
-				state, stack = dec.exitState(stateList), stack.exit(stateList)
+				state = dec.enter(stateList, off)
 			case '{':
-				state, stack = dec.enterState(stateHash), stack.enter(stateHash)
-			case '}':
-				state, stack = dec.exitState(stateHash), stack.exit(stateHash)
+				state = dec.enter(stateHash, off)
+			case ']', '}':
+				expect := stateList
+				if c == '}' {
+					expect = stateHash
+				}
+				if state != expect || (dec.implicit && dec.depth() == 1) {
+					err = dec.error(off, "unexpected "+string(c))
+					return
+				}
+				dec.setEnd(dec.top().node, off+1)
+				state = dec.exit(expect)
+				if dec.one && dec.depth() == 0 {
+					return dec.done(dec.top().node, off)
+				}
 			}
 			continue
+		} else if err = dec.readLiteral(c, off); err != nil {
+			return
 		}
 
-		var value []byte
-		if c == '`' || c == '"' {
-			if end, ok := dec.readBytes(c); !ok || !dec.endofLine() {
-				err = &FormatError{"quote format error"}
-				return
-			} else {
-				value = data[off+1 : end]
-			}
-		} else {
-			//value = bytes.TrimSpace(data[off:dec.readLine()])
-			value = bytes.TrimSpace(data[off:dec.readLine()])
+		n := dec.top().node
+		if state == stateHashItem || state == stateListItem {
+			state = dec.exit(state)
+		}
+		if dec.one && dec.depth() == 0 {
+			return dec.done(n, off)
 		}
+	}
 
-		//fmt.Printf("value:[%s] \n", string(value))
-		stack.node.Type = NodeLiteral
-		stack.node.Literal = string(value)
+	if dec.implicit && dec.depth() == 1 {
+		dec.setEnd(dec.top().node, dec.length)
+		state = dec.exit(stateHash)
+	}
 
-		if state == stateHashItem || state == stateListItem {
-			state, stack = dec.exitState(state), stack.exit(state)
+	if dec.depth() > 0 {
+		err = &FormatError{Message: "format error " + stateName(state), Pos: dec.top().node.Pos}
+		return
+	}
+
+	if node = dec.top().node; node == nil {
+		node = &Node{}
+	}
+	return dec.done(node, off)
+}
+
+// done return node of a finished parse, or error if nodes of the last token start at off exceed limits
+func (dec *decoder) done(node *Node, off int) (*Node, error) {
+	if err := dec.checkRead(off); err != nil {
+		return nil, err
+	}
+	return node, nil
+}
+
+// readKey read key of a hash item starts with c at off, and the : after it.
+// a key is quoted by " or `, or it's a heredoc, if it's empty, has : or newlines, or has spaces around,
+// \ at the end of line in a quoted key is kept.
+func (dec *decoder) readKey(c byte, off int) (name span, err error) {
+	if c == '"' || c == '`' {
+		end, ok := dec.readBytes(c)
+		if !ok && dec.more {
+			return name, errShort
+		} else if !ok {
+			return name, dec.error(off, "quote format error")
+		}
+		name = span{off + 1, end}
+		dec.skipSpaces()
+		if dec.readByte() != ':' {
+			return name, dec.error(off, "hash format error")
+		}
+	} else if tag := heredocStart(dec.data[off:]); tag != nil {
+		if name, _, err = dec.readHeredoc(off, tag, true); err != nil {
+			return
+		}
+	} else {
+		i, ok := dec.readBytesofLine(':')
+		if !ok || off == i {
+			return name, dec.error(off, "hash format error")
 		}
+		name = dec.trimSpan(off, i)
 	}
+	return name, dec.checkLiteral(dec.str(name), off)
+}
 
-	if dec.stateOff > 0 {
-		err = &FormatError{"format error " + stateName(dec.state())}
+// readLiteral read a literal starts with c at off as node of the top frame
+func (dec *decoder) readLiteral(c byte, off int) (err error) {
+	var value string
+	var valueEnd int
+	if c == '`' || c == '"' {
+		if end, ok := dec.readBytes(c); !ok && dec.more {
+			return errShort
+		} else if !ok || !dec.endofLine() {
+			return dec.error(off, "quote format error")
+		} else {
+			value = dec.src[off+1 : end]
+			valueEnd = end + 1
+		}
+	} else if tag := heredocStart(dec.data[off:]); tag != nil {
+		var sp span
+		if sp, valueEnd, err = dec.readHeredoc(off, tag, false); err != nil {
+			return
+		}
+		value = dec.str(sp)
+	} else {
+		value = strings.TrimSpace(dec.src[off:dec.readLine()])
+		valueEnd = off + len(value)
+	}
+	if err = dec.checkLiteral(value, off); err != nil {
 		return
 	}
 
-	return stack.node, nil
+	f := dec.top()
+	if f.node == nil {
+		f.node = dec.slab.node()
+	}
+	n := f.node
+	n.Type = NodeLiteral
+	if c == 'n' && value == "null" { // not quoted
+		n.Type = NodeNull
+	} else if c == '"' && strings.Contains(value, "\\\n") {
+		n.Literal = joinLines(value)
+	} else {
+		n.Literal = value
+	}
+	dec.setPos(n, off)
+	dec.setEnd(n, valueEnd)
+	return nil
+}
+
+// readInline read a list or hash on one line starts at dec.off, such as [a, b] and {k: v}.
+// items are separated by commas, spaces around them are trimmed,
+// an item which has comma, ], } or spaces around is quoted by " or `, which can't be escaped.
+func (dec *decoder) readInline() (*Node, error) {
+	off := dec.off
+	if err := dec.checkDepth(off); err != nil {
+		return nil, err
+	}
+	state, close, kind := stateList, byte(']'), "list"
+	if dec.data[off] == '{' {
+		state, close, kind = stateHash, '}', "hash"
+	}
+	node := dec.slab.node()
+	dec.setPos(node, off)
+	dec.nesting++
+	base := len(dec.items)
+
+	dec.off++
+	dec.skipSpaces()
+	if dec.off < dec.length && dec.data[dec.off] == close {
+		dec.off++
+	} else {
+		for {
+			name := span{}
+			if state == stateHash {
+				keyOff := dec.off
+				if keyOff < dec.length && (dec.data[keyOff] == '"' || dec.data[keyOff] == '`') {
+					c := dec.readByte()
+					e, ok := dec.readBytesofLine(c)
+					if !ok {
+						return nil, dec.error(keyOff, "quote format error")
+					}
+					name = span{keyOff + 1, e}
+					dec.skipSpaces()
+					if dec.readByte() != ':' {
+						return nil, dec.error(keyOff, "inline hash format error")
+					}
+				} else {
+					i := bytes.IndexAny(dec.data[keyOff:], ":,}\n")
+					if i < 0 || dec.data[keyOff+i] != ':' {
+						return nil, dec.error(keyOff, "inline hash format error")
+					}
+					name = dec.trimSpan(keyOff, keyOff+i)
+					if name.start == name.end {
+						return nil, dec.error(keyOff, "inline hash format error")
+					}
+					dec.off = keyOff + i + 1
+				}
+				if err := dec.checkLiteral(dec.str(name), keyOff); err != nil {
+					return nil, err
+				}
+				dec.skipSpaces()
+			}
+
+			x, err := dec.readInlineItem()
+			if err != nil {
+				return nil, err
+			}
+			dec.items = append(dec.items, item{name, x})
+
+			dec.skipSpaces()
+			c := dec.readByte()
+			if c == close {
+				break
+			} else if c == eof || c == '\n' {
+				return nil, dec.error(off, "inline "+kind+" is not closed")
+			} else if c != ',' {
+				return nil, dec.error(dec.off-1, "unexpected "+string(c)+" in inline "+kind)
+			}
+			dec.skipSpaces()
+		}
+	}
+
+	dec.collect(node, state, base)
+	dec.setEnd(node, dec.off)
+	return node, nil
+}
+
+// readInlineItem read an item of inline list or hash, an item not quoted ends before comma, ] or }
+func (dec *decoder) readInlineItem() (*Node, error) {
+	off := dec.off
+	c := byte(eof)
+	if off < dec.length {
+		c = dec.data[off]
+	}
+
+	var value string
+	var end int
+	switch c {
+	case '[', '{':
+		return dec.readInline()
+	case '"', '`':
+		dec.off++
+		e, ok := dec.readBytesofLine(c)
+		if !ok {
+			return nil, dec.error(off, "quote format error")
+		}
+		value, end = dec.src[off+1:e], e+1
+	default:
+		i := bytes.IndexAny(dec.data[off:], ",]}\n")
+		if i < 0 {
+			i = dec.length - off
+		}
+		value = strings.TrimSpace(dec.src[off : off+i])
+		end = off + len(value)
+		dec.off = off + i
+		if value == "" {
+			return nil, dec.error(off, "item of inline list or hash is empty")
+		}
+	}
+	if err := dec.checkLiteral(value, off); err != nil {
+		return nil, err
+	}
+
+	n := dec.slab.node()
+	n.Type = NodeLiteral
+	if c == 'n' && value == "null" { // not quoted
+		n.Type = NodeNull
+	} else {
+		n.Literal = value
+	}
+	dec.setPos(n, off)
+	dec.setEnd(n, end)
+	return n, nil
+}
+
+// skipSpaces skip spaces and tabs
+func (dec *decoder) skipSpaces() {
+	for dec.off < dec.length && (dec.data[dec.off] == ' ' || dec.data[dec.off] == '\t') {
+		dec.off++
+	}
+}
+
+// heredocStart return tag if data starts with <<tag and a newline, tag is made of letters, digits and _
+func heredocStart(data []byte) []byte {
+	if len(data) < 3 || data[0] != '<' || data[1] != '<' {
+		return nil
+	}
+	i := 2
+	for ; i < len(data); i++ {
+		c := data[i]
+		if !(c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z' || c >= '0' && c <= '9' || c == '_') {
+			break
+		}
+	}
+	if i == 2 {
+		return nil
+	}
+	rest := data[i:]
+	if j := bytes.IndexByte(rest, '\n'); j >= 0 {
+		rest = rest[:j]
+	}
+	if len(bytes.TrimRight(rest, " \t\r")) > 0 {
+		return nil
+	}
+	return data[2:i]
+}
+
+// readHeredoc read a literal starts with <<tag, value is lines between it and the line of tag, they are kept as they are.
+// if key is true, it's a key of hash, the line of tag is followed by : and the value of item, dec.off is after the :
+func (dec *decoder) readHeredoc(off int, tag []byte, key bool) (value span, end int, err error) {
+	nl, ok := dec.readBytes('\n')
+	start := nl + 1
+	for ok {
+		lineStart := dec.off
+		lineEnd := dec.readLine()
+		line := dec.data[lineStart:lineEnd]
+		if n := heredocEnd(line, tag, key); n > 0 {
+			end = lineStart + n
+			if key {
+				dec.off = end
+			}
+			if lineStart == start {
+				return span{start, start}, end, nil
+			}
+			return span{start, lineStart - 1}, end, nil
+		}
+		ok = lineEnd < dec.length
+	}
+	if dec.more {
+		return value, 0, errShort
+	}
+	return value, 0, dec.error(off, "heredoc <<"+string(tag)+" is not closed")
+}
+
+// heredocEnd return length of the tag and spaces before it if line closes heredoc of tag, or 0.
+// if key is true, the tag is followed by : and the length includes the :
+func heredocEnd(line []byte, tag []byte, key bool) int {
+	rest := bytes.TrimLeft(line, " \t")
+	if !bytes.HasPrefix(rest, tag) {
+		return 0
+	}
+	n := len(line) - len(rest) + len(tag)
+	if !key {
+		if len(bytes.TrimRight(rest[len(tag):], " \t\r")) > 0 {
+			return 0
+		}
+		return n
+	}
+	after := bytes.TrimLeft(rest[len(tag):], " \t")
+	if len(after) == 0 || after[0] != ':' {
+		return 0
+	}
+	return len(line) - len(after) + 1
+}
+
+// joinLines remove \ at the end of line and spaces at the begin of next line, they are written by long literals
+func joinLines(value string) string {
+	var buf bytes.Buffer
+	for {
+		i := strings.Index(value, "\\\n")
+		if i < 0 {
+			buf.WriteString(value)
+			return buf.String()
+		}
+		buf.WriteString(value[:i])
+		value = strings.TrimLeft(value[i+2:], " \t")
+	}
 }
 
 // Unmarshal unmarshal data to the value pointed to by v.
@@ -297,3 +800,22 @@ func Unmarshal(data []byte, v interface{}) error {
 	}
 	return node.Value(v)
 }
+
+// UnmarshalOptions is like Unmarshal, but parses with opts.Limits and decodes in the way of opts
+func UnmarshalOptions(data []byte, v interface{}, opts DecoderOptions) error {
+	node, err := ParseLimits(data, opts.Limits)
+	if err != nil {
+		return err
+	}
+	return node.ValueOptions(v, opts)
+}
+
+// UnmarshalStrict is like Unmarshal, but unknown keys, literals can not be converted,
+// mismatched node types and overflow are returned as MultiError.
+func UnmarshalStrict(data []byte, v interface{}) error {
+	node, err := Parse(data)
+	if err != nil {
+		return err
+	}
+	return node.ValueStrict(v)
+}
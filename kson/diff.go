@@ -0,0 +1,76 @@
+// Copyright 2012 by sdm. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package kson
+
+import (
+	"strconv"
+)
+
+// Difference is a difference of two nodes at Path, A is nil if the node is added and B is nil if it's removed
+type Difference struct {
+	Path string
+	A    *Node
+	B    *Node
+}
+
+// String return difference as + path: b, - path: a or ~ path: a -> b, values are in json
+func (d Difference) String() string {
+	path := d.Path
+	if path == "" {
+		path = "."
+	}
+	switch {
+	case d.A == nil:
+		return "+ " + path + ": " + string(d.B.JSON(false))
+	case d.B == nil:
+		return "- " + path + ": " + string(d.A.JSON(false))
+	}
+	return "~ " + path + ": " + string(d.A.JSON(false)) + " -> " + string(d.B.JSON(false))
+}
+
+// Diff compare node a and b, return differences in order of keys and items of a, then added keys of b.
+// items of lists are compared by index.
+func Diff(a, b *Node) []Difference {
+	return diffNode(nil, a, b, "")
+}
+
+func diffNode(diffs []Difference, a, b *Node, path string) []Difference {
+	if a.Type != b.Type {
+		return append(diffs, Difference{Path: path, A: a, B: b})
+	}
+
+	switch a.Type {
+	case NodeLiteral:
+		if a.Literal != b.Literal {
+			diffs = append(diffs, Difference{Path: path, A: a, B: b})
+		}
+	case NodeList:
+		for i, x := range a.List {
+			p := path + "[" + strconv.Itoa(i) + "]"
+			if i < len(b.List) {
+				diffs = diffNode(diffs, x, b.List[i], p)
+			} else {
+				diffs = append(diffs, Difference{Path: p, A: x})
+			}
+		}
+		for i := len(a.List); i < len(b.List); i++ {
+			diffs = append(diffs, Difference{Path: path + "[" + strconv.Itoa(i) + "]", B: b.List[i]})
+		}
+	case NodeHash:
+		for _, name := range a.orderedKeys() {
+			p := appendPathKey(path, name)
+			if y, ok := b.Hash[name]; ok {
+				diffs = diffNode(diffs, a.Hash[name], y, p)
+			} else {
+				diffs = append(diffs, Difference{Path: p, A: a.Hash[name]})
+			}
+		}
+		for _, name := range b.orderedKeys() {
+			if _, ok := a.Hash[name]; !ok {
+				diffs = append(diffs, Difference{Path: appendPathKey(path, name), B: b.Hash[name]})
+			}
+		}
+	}
+	return diffs
+}
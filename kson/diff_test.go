@@ -0,0 +1,73 @@
+// Copyright 2012 by sdm. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package kson_test
+
+import (
+	"github.com/sdming/kiss/kson"
+	"github.com/sdming/kiss/ktest"
+	"strings"
+	"testing"
+)
+
+func TestDiff(t *testing.T) {
+	a, err := kson.Parse([]byte(`{
+	Name:	app
+	Port:	8000
+	Hosts:	[
+		a.io
+		b.io
+	]
+	Log:	{
+		Level:	debug
+		File:	app.log
+	}
+	Debug:	true
+}`))
+	if err != nil {
+		t.Error("parse a error", err)
+		return
+	}
+
+	b, err := kson.Parse([]byte(`{
+	Name:	app
+	Port:	9000
+	Hosts:	[
+		a.io
+	]
+	Log:	{
+		Level:	info
+		File:	app.log
+	}
+	Debug:	[
+		true
+	]
+	Env:	{
+		auth_url:	http://auth.io
+	}
+}`))
+	if err != nil {
+		t.Error("parse b error", err)
+		return
+	}
+
+	ktest.Equal(t, "diff a a", 0, len(kson.Diff(a, a)))
+
+	var lines []string
+	for _, d := range kson.Diff(a, b) {
+		lines = append(lines, d.String())
+	}
+	expect := []string{
+		`~ Port: "8000" -> "9000"`,
+		`- Hosts[1]: "b.io"`,
+		`~ Log.Level: "debug" -> "info"`,
+		`~ Debug: "true" -> ["true"]`,
+		`+ Env: {"auth_url":"http://auth.io"}`,
+	}
+	ktest.Equal(t, "diff a b", strings.Join(expect, "\n"), strings.Join(lines, "\n"))
+
+	diffs := kson.Diff(b, a)
+	ktest.Equal(t, "diff b a", 5, len(diffs))
+	ktest.Equal(t, "added", "Hosts[1]", diffs[1].Path)
+	ktest.Equal(t, "added", true, diffs[1].A == nil)
+}
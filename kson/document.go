@@ -0,0 +1,474 @@
+// Copyright 2012 by sdm. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package kson
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Document is a kson file which keeps source text, key order, comments and blank lines.
+// It can be edited by path and written back with minimal changes.
+type Document struct {
+	filename string
+	src      []byte
+	root     *Node
+	ends     map[*Node]int // offsets where nodes end in src, exclusive
+}
+
+// ParseDocument parse data like ParseFile, lines start with # are comments
+func ParseDocument(data []byte) (*Document, error) {
+	doc := &Document{src: data}
+	if err := doc.reparse(); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+// ParseDocumentFile read and parse a file like ParseFile
+func ParseDocumentFile(filename string) (*Document, error) {
+	data, err := ioutil.ReadFile(filename)
+	if err != nil {
+		return nil, err
+	}
+
+	doc := &Document{filename: filename, src: data}
+	if err := doc.reparse(); err != nil {
+		return nil, err
+	}
+	return doc, nil
+}
+
+func (doc *Document) reparse() error {
+	dec := newDecoder(doc.src)
+	dec.filename = doc.filename
+	dec.comments = true
+	dec.implicit = true
+	dec.ends = make(map[*Node]int)
+
+	root, err := dec.parse()
+	if err != nil {
+		return err
+	}
+	doc.root, doc.ends = root, dec.ends
+	return nil
+}
+
+// Root return root node of document, it's a hash
+func (doc *Document) Root() *Node {
+	return doc.root
+}
+
+// Bytes return source of document, it should not be modified
+func (doc *Document) Bytes() []byte {
+	return doc.src
+}
+
+// WriteTo write source of document to w
+func (doc *Document) WriteTo(w io.Writer) (int64, error) {
+	n, err := w.Write(doc.src)
+	return int64(n), err
+}
+
+// Save write document to a file, the file is replaced at once by renaming a temp file
+func (doc *Document) Save(filename string) error {
+	mode := os.FileMode(0644)
+	if fi, err := os.Stat(filename); err == nil {
+		mode = fi.Mode()
+	}
+
+	f, err := ioutil.TempFile(filepath.Dir(filename), "."+filepath.Base(filename))
+	if err != nil {
+		return err
+	}
+	_, err = f.Write(doc.src)
+	if err == nil {
+		err = f.Chmod(mode)
+	}
+	if e := f.Close(); err == nil {
+		err = e
+	}
+	if err == nil {
+		err = os.Rename(f.Name(), filename)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+	}
+	return err
+}
+
+// Get return node by path, such as Roles[0].Allow
+func (doc *Document) Get(path string) (node *Node, ok bool) {
+	elems, err := parsePath(path)
+	if err != nil {
+		return
+	}
+
+	node = doc.root
+	for _, el := range elems {
+		if node, ok = node.elem(el); !ok {
+			return
+		}
+	}
+	return node, true
+}
+
+// Comments return comment lines just above the node of path, # is removed
+func (doc *Document) Comments(path string) []string {
+	node, ok := doc.Get(path)
+	if !ok || node == doc.root {
+		return nil
+	}
+
+	var comments []string
+	end := doc.lineStart(node.Pos.Offset)
+	for start := doc.commentStart(end); start < end; start = doc.nextLine(start) {
+		line := strings.TrimSpace(string(doc.src[start:doc.nextLine(start)]))
+		comments = append(comments, strings.TrimSpace(line[1:]))
+	}
+	return comments
+}
+
+// Format return document in canonical format of opts, the root hash is written without { and }.
+// comments above items and blank lines between items are kept.
+func (doc *Document) Format(opts EncoderOptions) []byte {
+	var buf bytes.Buffer
+	e := &encoder{Buffer: &buf, opts: opts, implicit: true, doc: doc}
+	e.visitNode(doc.root)
+	return buf.Bytes()
+}
+
+// Set set value of path, value is a *Node or any value can be marshaled.
+// Hashes of path are created if they don't exist, a list item can be appended by index of len(list).
+// A list or hash on one line, such as [a, b], is written again with the change.
+func (doc *Document) Set(path string, value interface{}) error {
+	elems, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	if len(elems) == 0 {
+		return errors.New("path is empty")
+	}
+
+	node, err := valueNode(value)
+	if err != nil {
+		return err
+	}
+
+	parent := doc.root
+	var inline *Node // the outermost list or hash on one line in path, it's elems[at-1]
+	at := 0
+	for i, el := range elems {
+		child, ok := parent.elem(el)
+		if ok {
+			if i == len(elems)-1 {
+				if inline != nil {
+					return doc.editInline(inline, elems[at:], node, path)
+				}
+				return doc.replace(child, node)
+			}
+			parent = child
+			if inline == nil && doc.inline(child) {
+				inline, at = child, i+1
+			}
+			continue
+		}
+
+		// create hashes for the rest of path
+		for j := len(elems) - 1; j > i; j-- {
+			if elems[j].kind != selectKey {
+				return &NodeNotExistsError{Name: path, Pos: parent.Pos}
+			}
+			node = &Node{
+				Type: NodeHash,
+				Hash: map[string]*Node{elems[j].key: node},
+				Keys: []string{elems[j].key},
+			}
+		}
+		if inline != nil {
+			return doc.editInline(inline, elems[at:i+1], node, path)
+		}
+		return doc.insert(parent, el, node, path)
+	}
+	return nil
+}
+
+// Delete remove node of path and comment lines just above it
+func (doc *Document) Delete(path string) error {
+	elems, err := parsePath(path)
+	if err != nil {
+		return err
+	}
+	if len(elems) == 0 {
+		return errors.New("can not delete root")
+	}
+
+	node, ok := doc.Get(path)
+	if !ok {
+		return &NodeNotExistsError{Name: path}
+	}
+
+	parent := doc.root
+	for i, el := range elems[:len(elems)-1] {
+		parent, _ = parent.elem(el)
+		if doc.inline(parent) {
+			return doc.editInline(parent, elems[i+1:], nil, path)
+		}
+	}
+	// comments just above node are removed too, and one of blank lines around it
+	start, end := doc.commentStart(doc.lineStart(node.Pos.Offset)), doc.nextLine(doc.ends[node])
+	if (start == 0 || doc.blankLine(doc.lineStart(start-1))) && end < len(doc.src) && doc.blankLine(end) {
+		end = doc.nextLine(end)
+	}
+	return doc.splice(start, end, "")
+}
+
+func (doc *Document) replace(node *Node, value *Node) error {
+	start, end := node.Pos.Offset, doc.ends[node]
+	text := encodeNode(value, doc.indentOf(start))
+
+	// key: is followed by nothing
+	if start == end && start > 0 && doc.src[start-1] == ':' && text != "" {
+		text = "\t" + text
+	}
+	return doc.splice(start, end, text)
+}
+
+func (doc *Document) insert(parent *Node, el selector, value *Node, path string) error {
+	var last *Node
+	switch {
+	case parent.Type == NodeHash && el.kind == selectKey:
+		for _, x := range parent.Hash {
+			if last == nil || doc.ends[x] > doc.ends[last] {
+				last = x
+			}
+		}
+	case parent.Type == NodeList && el.kind == selectIndex && el.index == len(parent.List):
+		if len(parent.List) > 0 {
+			last = parent.List[len(parent.List)-1]
+		}
+	default:
+		return &NodeNotExistsError{Name: path, Pos: parent.Pos}
+	}
+
+	var at int
+	var indent string
+	if last != nil {
+		at = doc.nextLine(doc.ends[last])
+		indent = doc.indentOf(last.Pos.Offset)
+	} else if parent == doc.root {
+		at = len(doc.src)
+	} else {
+		at = doc.nextLine(parent.Pos.Offset)
+		indent = doc.indentOf(parent.Pos.Offset) + "\t"
+	}
+
+	text := indent
+	if el.kind == selectKey {
+		text += encodeKey(el.key, indent)
+	}
+	if s := encodeNode(value, indent); s != "" {
+		if el.kind == selectKey {
+			text += "\t"
+		}
+		text += s
+	}
+	text += "\n"
+
+	if at > 0 && doc.src[at-1] != '\n' {
+		text = "\n" + text
+	}
+	return doc.splice(at, at, text)
+}
+
+// editInline set node of path rel in inline to value, or delete it if value is nil.
+// items of a list or hash on one line have no lines of their own, so inline is written again.
+func (doc *Document) editInline(inline *Node, rel []selector, value *Node, path string) error {
+	x := inline.Clone()
+	parent := x
+	for _, el := range rel[:len(rel)-1] {
+		parent, _ = parent.elem(el)
+	}
+
+	el := rel[len(rel)-1]
+	switch {
+	case parent.Type == NodeHash && el.kind == selectKey:
+		if value == nil {
+			parent.remove(el.key)
+		} else {
+			parent.put(el.key, value)
+		}
+	case parent.Type == NodeList && el.kind == selectIndex && el.index >= 0 && el.index <= len(parent.List):
+		switch {
+		case value == nil:
+			parent.List = append(parent.List[:el.index], parent.List[el.index+1:]...)
+		case el.index == len(parent.List):
+			parent.List = append(parent.List, value)
+		default:
+			parent.List[el.index] = value
+		}
+	default:
+		return &NodeNotExistsError{Name: path, Pos: parent.Pos}
+	}
+
+	start := inline.Pos.Offset
+	return doc.splice(start, doc.ends[inline], encodeInline(x, doc.indentOf(start)))
+}
+
+// splice replace src[start:end] with text, parse document again
+func (doc *Document) splice(start, end int, text string) error {
+	src := make([]byte, 0, len(doc.src)-(end-start)+len(text))
+	src = append(src, doc.src[:start]...)
+	src = append(src, text...)
+	src = append(src, doc.src[end:]...)
+
+	old := doc.src
+	doc.src = src
+	if err := doc.reparse(); err != nil {
+		doc.src = old
+		return err
+	}
+	return nil
+}
+
+// lineStart return offset of the line begin of off
+func (doc *Document) lineStart(off int) int {
+	return bytes.LastIndex(doc.src[:off], []byte{'\n'}) + 1
+}
+
+// commentStart return offset of the first of comment lines just above the line starts at off
+func (doc *Document) commentStart(off int) int {
+	for off > 0 {
+		prev := doc.lineStart(off - 1)
+		if !bytes.HasPrefix(bytes.TrimSpace(doc.src[prev:off]), []byte{'#'}) {
+			break
+		}
+		off = prev
+	}
+	return off
+}
+
+// blankLine return true if the line starts at off has spaces only
+func (doc *Document) blankLine(off int) bool {
+	return len(bytes.TrimSpace(doc.src[off:doc.nextLine(off)])) == 0
+}
+
+// nextLine return offset of the line after off
+func (doc *Document) nextLine(off int) int {
+	if i := bytes.IndexByte(doc.src[off:], '\n'); i >= 0 {
+		return off + i + 1
+	}
+	return len(doc.src)
+}
+
+// itemsStart return offset of the line after item prev of node, or the first line in node if prev is nil
+func (doc *Document) itemsStart(node, prev *Node) int {
+	switch {
+	case prev != nil:
+		return doc.nextLine(doc.ends[prev])
+	case node == doc.root:
+		return 0
+	}
+	return doc.nextLine(node.Pos.Offset)
+}
+
+// itemsEnd return offset of the line which closes node
+func (doc *Document) itemsEnd(node *Node) int {
+	if node == doc.root {
+		return len(doc.src)
+	}
+	return doc.lineStart(doc.ends[node] - 1)
+}
+
+// inline return true if n is a list or hash on one line of source, such as [a, b]
+func (doc *Document) inline(n *Node) bool {
+	end, ok := doc.ends[n]
+	return ok && (n.Type == NodeList || n.Type == NodeHash) && bytes.IndexByte(doc.src[n.Pos.Offset:end], '\n') < 0
+}
+
+// between return comment lines in src[from:to], blank is true if there are blank lines before the first comment.
+// blank lines after a comment are kept as an empty line, so comment blocks are still apart when they are written
+func (doc *Document) between(from, to int) (lines []string, blank bool) {
+	pending := false
+	for from < to {
+		end := doc.nextLine(from)
+		if end > to {
+			end = to
+		}
+		line := strings.TrimSpace(string(doc.src[from:end]))
+		if line == "" {
+			blank = blank || len(lines) == 0
+			pending = len(lines) > 0
+		} else if line[0] == '#' {
+			if pending {
+				lines = append(lines, "")
+			}
+			lines, pending = append(lines, line), false
+		}
+		from = end
+	}
+	if pending {
+		lines = append(lines, "")
+	}
+	return
+}
+
+// indentOf return leading spaces of the line of off
+func (doc *Document) indentOf(off int) string {
+	start := doc.lineStart(off)
+	end := start
+	for end < len(doc.src) && (doc.src[end] == ' ' || doc.src[end] == '\t') {
+		end++
+	}
+	return string(doc.src[start:end])
+}
+
+// valueNode convert value to a node
+func valueNode(value interface{}) (*Node, error) {
+	switch x := value.(type) {
+	case *Node:
+		return x, nil
+	case Node:
+		return &x, nil
+	}
+
+	data, err := Marshal(value)
+	if err != nil {
+		return nil, err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return &Node{Type: NodeLiteral}, nil
+	}
+	return Parse(data)
+}
+
+// encodeNode return kson text of node, prefix is written at the begin of each line but the first
+func encodeNode(n *Node, prefix string) string {
+	var buf bytes.Buffer
+	e := &encoder{Buffer: &buf, prefix: prefix}
+	e.visitNode(n)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// encodeKey return kson text of key and : of a hash item, prefix is written at the begin of each line but the first
+func encodeKey(key string, prefix string) string {
+	var buf bytes.Buffer
+	e := &encoder{Buffer: &buf, prefix: prefix}
+	e.writeKey(key)
+	return buf.String()
+}
+
+// encodeInline is like encodeNode, but lists and hashes are written on one line if they can be
+func encodeInline(n *Node, prefix string) string {
+	var buf bytes.Buffer
+	e := &encoder{Buffer: &buf, prefix: prefix, opts: EncoderOptions{InlineWidth: math.MaxInt32}}
+	e.visitNode(n)
+	return strings.TrimSuffix(buf.String(), "\n")
+}
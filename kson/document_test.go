@@ -0,0 +1,305 @@
+// Copyright 2012 by sdm. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package kson_test
+
+import (
+	"github.com/sdming/kiss/kson"
+	"github.com/sdming/kiss/ktest"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+var documentData = `# app config
+Log_Level:	debug
+
+# listen port
+Listen:		8000
+
+Roles: [
+	{
+		Name:	user
+		Allow:	[
+			/user
+		]
+	}
+]
+
+Db_Log:	{
+	# database
+	Host:		127.0.0.1
+	User:		user
+}
+Empty:
+`
+
+func TestDocumentKeyOrder(t *testing.T) {
+	doc, err := kson.ParseDocument([]byte(documentData))
+	if err != nil {
+		t.Error("parse document error", err)
+		return
+	}
+
+	ktest.Equal(t, "keys", "[Log_Level Listen Roles Db_Log Empty]", fmtKeys(doc.Root().Keys))
+	ktest.Equal(t, "comments", "[listen port]", fmtKeys(doc.Comments("Listen")))
+	ktest.Equal(t, "comments", "[database]", fmtKeys(doc.Comments("Db_Log.Host")))
+
+	node, ok := doc.Get("Roles[0].Allow[0]")
+	if !ok {
+		t.Error("get Roles[0].Allow[0] fail")
+		return
+	}
+	ktest.Equal(t, "Roles[0].Allow[0]", "/user", node.Literal)
+}
+
+func fmtKeys(keys []string) string {
+	s := "["
+	for i, k := range keys {
+		if i > 0 {
+			s += " "
+		}
+		s += k
+	}
+	return s + "]"
+}
+
+func testDocumentEdit(t *testing.T, name string, edit func(doc *kson.Document) error, expect string) {
+	doc, err := kson.ParseDocument([]byte(documentData))
+	if err != nil {
+		t.Error("parse document error", err)
+		return
+	}
+	if err = edit(doc); err != nil {
+		t.Errorf("%s: edit error %v", name, err)
+		return
+	}
+	if actual := string(doc.Bytes()); actual != expect {
+		t.Errorf("%s: expect\n%s\nactual\n%s", name, expect, actual)
+	}
+}
+
+func TestDocumentSet(t *testing.T) {
+	testDocumentEdit(t, "replace literal", func(doc *kson.Document) error {
+		return doc.Set("Listen", 9000)
+	}, replace(documentData, "Listen:\t\t8000", "Listen:\t\t9000"))
+
+	testDocumentEdit(t, "replace empty", func(doc *kson.Document) error {
+		return doc.Set("Empty", "value")
+	}, replace(documentData, "Empty:", "Empty:\tvalue"))
+
+	testDocumentEdit(t, "replace list item", func(doc *kson.Document) error {
+		return doc.Set("Roles[0].Allow[0]", "/admin")
+	}, replace(documentData, "\t\t\t/user", "\t\t\t/admin"))
+
+	testDocumentEdit(t, "append list item", func(doc *kson.Document) error {
+		return doc.Set("Roles[0].Allow[1]", "/order")
+	}, replace(documentData, "\t\t\t/user\n", "\t\t\t/user\n\t\t\t/order\n"))
+
+	testDocumentEdit(t, "add key", func(doc *kson.Document) error {
+		return doc.Set("Db_Log.Password", "secret")
+	}, replace(documentData, "\tUser:\t\tuser\n", "\tUser:\t\tuser\n\tPassword:\tsecret\n"))
+
+	testDocumentEdit(t, "add quoted key", func(doc *kson.Document) error {
+		return doc.Set(`Db_Log["a: b"]`, "c")
+	}, replace(documentData, "\tUser:\t\tuser\n", "\tUser:\t\tuser\n\t\"a: b\":\tc\n"))
+
+	testDocumentEdit(t, "add hash", func(doc *kson.Document) error {
+		return doc.Set("Env.auth", "http://auth.io")
+	}, documentData+"Env:\t{\n\tauth:http://auth.io\n}\n")
+
+	testDocumentEdit(t, "replace hash", func(doc *kson.Document) error {
+		return doc.Set("Db_Log", map[string]string{"Host": "db.local"})
+	}, replace(documentData, "{\n\t# database\n\tHost:\t\t127.0.0.1\n\tUser:\t\tuser\n}", "{\n\tHost:db.local\n}"))
+}
+
+func TestDocumentDelete(t *testing.T) {
+	testDocumentEdit(t, "delete literal", func(doc *kson.Document) error {
+		return doc.Delete("Listen")
+	}, replace(documentData, "# listen port\nListen:\t\t8000\n\n", ""))
+
+	testDocumentEdit(t, "delete first literal", func(doc *kson.Document) error {
+		return doc.Delete("Log_Level")
+	}, replace(documentData, "# app config\nLog_Level:\tdebug\n\n", ""))
+
+	testDocumentEdit(t, "delete hash", func(doc *kson.Document) error {
+		return doc.Delete("Db_Log")
+	}, replace(documentData, "Db_Log:\t{\n\t# database\n\tHost:\t\t127.0.0.1\n\tUser:\t\tuser\n}\n", ""))
+
+	testDocumentEdit(t, "delete list item", func(doc *kson.Document) error {
+		return doc.Delete("Roles[0]")
+	}, replace(documentData, "\t{\n\t\tName:\tuser\n\t\tAllow:\t[\n\t\t\t/user\n\t\t]\n\t}\n", ""))
+
+	doc, _ := kson.ParseDocument([]byte(documentData))
+	if err := doc.Delete("Missing"); err == nil {
+		t.Error("delete missing key should fail")
+	}
+}
+
+func TestDocumentSave(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kson")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	filename := filepath.Join(dir, "app.kson")
+	if err = ioutil.WriteFile(filename, []byte(documentData), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	doc, err := kson.ParseDocumentFile(filename)
+	if err != nil {
+		t.Error("parse document file error", err)
+		return
+	}
+	if err = doc.Set("Log_Level", "info"); err != nil {
+		t.Error("set error", err)
+		return
+	}
+	if err = doc.Save(filename); err != nil {
+		t.Error("save error", err)
+		return
+	}
+
+	n, err := kson.ParseFile(filename)
+	if err != nil {
+		t.Error("parse saved file error", err)
+		return
+	}
+	ktest.Equal(t, "Log_Level", "info", n.ChildString("Log_Level"))
+
+	fi, _ := os.Stat(filename)
+	ktest.Equal(t, "file mode", os.FileMode(0600), fi.Mode())
+}
+
+func TestDocumentFormat(t *testing.T) {
+	doc, err := kson.ParseDocument([]byte(documentData + "# the end\n"))
+	if err != nil {
+		t.Error("parse document error", err)
+		return
+	}
+
+	expect := `# app config
+Log_Level: debug
+
+# listen port
+Listen:    8000
+
+Roles:     [
+	{
+		Name:  user
+		Allow: [
+			/user
+		]
+	}
+]
+
+Db_Log:    {
+	# database
+	Host: 127.0.0.1
+	User: user
+}
+Empty:     ""
+# the end
+`
+	actual := string(doc.Format(kson.EncoderOptions{AlignValues: true, Compact: true}))
+	if actual != expect {
+		t.Errorf("format: expect\n%s\nactual\n%s", expect, actual)
+	}
+
+	doc, err = kson.ParseDocument([]byte(actual))
+	if err != nil {
+		t.Error("parse formatted document error", err)
+		return
+	}
+	ktest.Equal(t, "format again", actual, string(doc.Format(kson.EncoderOptions{AlignValues: true, Compact: true})))
+	ktest.Equal(t, "comments", "[database]", fmtKeys(doc.Comments("Db_Log.Host")))
+}
+
+func TestDocumentFormatCommentBlocks(t *testing.T) {
+	data := "# app config\n\n# log\nLog_Level:\tdebug\nDb:\t{\n\tHost:\t127.0.0.1\n\n\t# the end\n\n}\n"
+	doc, err := kson.ParseDocument([]byte(data))
+	if err != nil {
+		t.Error("parse document error", err)
+		return
+	}
+	expect := "# app config\n\n# log\nLog_Level: debug\nDb:        {\n\tHost: 127.0.0.1\n\n\t# the end\n}\n"
+	ktest.Equal(t, "blank line between comments", expect, string(doc.Format(kson.EncoderOptions{AlignValues: true, Compact: true})))
+	ktest.Equal(t, "comments", "[log]", fmtKeys(doc.Comments("Log_Level")))
+}
+
+func replace(s, old, new string) string {
+	i := len(s)
+	for j := 0; j+len(old) <= len(s); j++ {
+		if s[j:j+len(old)] == old {
+			i = j
+			break
+		}
+	}
+	if i == len(s) {
+		panic("replace: " + old + " not found")
+	}
+	return s[:i] + new + s[i+len(old):]
+}
+
+func TestDocumentInline(t *testing.T) {
+	data := "# browsers\nBrowser:\t[ie, chrome]\nDb:\t{Host: a, Port: 1}\nHosts:\t[\n\ta.io\n\tb.io\n]\n"
+	edit := func(name string, edit func(doc *kson.Document) error, expect string) {
+		doc, err := kson.ParseDocument([]byte(data))
+		if err != nil {
+			t.Error("parse document error", err)
+			return
+		}
+		if err = edit(doc); err != nil {
+			t.Errorf("%s: edit error %v", name, err)
+			return
+		}
+		ktest.Equal(t, name, expect, string(doc.Bytes()))
+	}
+
+	edit("append", func(doc *kson.Document) error {
+		return doc.Set("Browser[2]", "firefox")
+	}, replace(data, "[ie, chrome]", "[ie, chrome, firefox]"))
+
+	edit("quote", func(doc *kson.Document) error {
+		return doc.Set("Browser[0]", "a, b")
+	}, replace(data, "[ie, chrome]", "[\"a, b\", chrome]"))
+
+	edit("delete", func(doc *kson.Document) error {
+		return doc.Delete("Browser[0]")
+	}, replace(data, "[ie, chrome]", "[chrome]"))
+
+	edit("add key", func(doc *kson.Document) error {
+		return doc.Set("Db.User", "root")
+	}, replace(data, "{Host: a, Port: 1}", "{Host: a, Port: 1, User: root}"))
+
+	edit("add hash", func(doc *kson.Document) error {
+		return doc.Set("Db.Env.x", "1")
+	}, replace(data, "{Host: a, Port: 1}", "{Host: a, Port: 1, Env: {x: 1}}"))
+
+	edit("not on one line", func(doc *kson.Document) error {
+		return doc.Set("Browser[1]", "multi\nline")
+	}, replace(data, "[ie, chrome]", "[\n\tie\n\t\"multi\nline\"\n]"))
+
+	doc, err := kson.ParseDocument([]byte(data))
+	if err != nil {
+		t.Error("parse document error", err)
+		return
+	}
+	opts := kson.EncoderOptions{AlignValues: true, Compact: true, TrailingNewline: true}
+	ktest.Equal(t, "format", "# browsers\nBrowser: [ie, chrome]\nDb:      {Host: a, Port: 1}\nHosts:   [\n\ta.io\n\tb.io\n]\n",
+		string(doc.Format(opts)))
+
+	opts.InlineWidth = 40
+	ktest.Equal(t, "format inline", "# browsers\nBrowser: [ie, chrome]\nDb:      {Host: a, Port: 1}\nHosts:   [a.io, b.io]\n",
+		string(doc.Format(opts)))
+
+	if doc, err = kson.ParseDocument([]byte(replace(data, "\ta.io\n", "\t# first\n\ta.io\n"))); err != nil {
+		t.Error("parse document error", err)
+		return
+	}
+	ktest.Equal(t, "format comments", "# browsers\nBrowser: [ie, chrome]\nDb:      {Host: a, Port: 1}\nHosts:   [\n\t# first\n\ta.io\n\tb.io\n]\n",
+		string(doc.Format(opts)))
+}
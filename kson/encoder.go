@@ -5,17 +5,58 @@ package kson
 
 import (
 	"bytes"
+	"encoding"
 	"errors"
 	"fmt"
 	"github.com/sdming/kiss/gotype"
+	"io"
 	"reflect"
 	"runtime"
+	"sort"
+	"strconv"
 	"strings"
+	"sync"
+	"time"
+	"unicode"
+	"unicode/utf8"
 )
 
+// EncoderOptions controls format of kson encoding
+type EncoderOptions struct {
+	Indent          string // indent of each level, a tab if empty
+	SortKeys        bool   // write keys of maps in sorted order, otherwise they are in random order
+	AlignValues     bool   // pad after colon so values of a hash start at the same column
+	Compact         bool   // don't write a blank line after nested list or hash
+	TrailingNewline bool   // end output with a newline
+	LineWidth       int    // wrap literals which exceed LineWidth into quoted lines end with \, 0 means no limit
+	TimeLayout      string // layout of time.Time, time.RFC3339Nano if empty
+	Implicit        bool   // write a hash at top level without { and }, as content of a file for ParseFile
+
+	// InlineWidth writes a list or hash on one line, such as [a, b] and {k: v},
+	// if the line is not longer than InlineWidth columns, 0 means never
+	InlineWidth int
+}
+
+// flushSize is size of lines an Encoder keeps before they are written to its writer
+const flushSize = 4096
+
 type encoder struct {
-	bytes.Buffer
-	deep int
+	*bytes.Buffer
+	w      io.Writer // lines in buffer are written to w when there are flushSize of them, if it's not nil
+	deep   int
+	prefix string // written at the begin of each line but the first
+	opts   EncoderOptions
+	closed bool // the last value is a list or hash
+	blank  bool // a blank line will be written before the next item or the end of list or hash
+	col    int  // column of current line, tab is 8 columns
+
+	implicit bool      // the next hash is written without { and }
+	doc      *Document // keeps comments and blank lines of nodes of doc
+
+	inline bool // a list or hash is being written on one line from at, see tryInline
+	at     int  // where the list or hash on one line starts in buffer
+	failed bool // the list or hash can't be written on one line
+	limit  int  // max columns of the line, 0 means no limit
 }
 
 func (e *encoder) indentOuter() {
@@ -28,64 +69,530 @@ func (e *encoder) indentInner() {
 	e.deep++
 }
 
+func (e *encoder) indentString() string {
+	if e.opts.Indent == "" {
+		return indent
+	}
+	return e.opts.Indent
+}
+
+// tabs is indent of 16 levels, most of values are written by one call of WriteString
+const tabs = "\t\t\t\t\t\t\t\t\t\t\t\t\t\t\t\t"
+
 func (e *encoder) indent() {
+	s := e.indentString()
+	if e.prefix == "" && s == indent && e.deep <= len(tabs) {
+		e.WriteString(tabs[:e.deep])
+		e.col = 8 * e.deep
+		return
+	}
+	e.WriteString(e.prefix)
 	for i := 0; i < e.deep; i++ {
-		e.WriteString(indent)
+		e.WriteString(s)
+	}
+	e.col = textWidth(e.prefix) + e.deep*textWidth(s)
+}
+
+// textWidth return columns of s, tab is 8 columns
+func textWidth(s string) int {
+	n := 0
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\t' {
+			n += 8
+		} else if s[i] >= utf8.RuneSelf {
+			return n + utf8.RuneCountInString(s[i:]) + 7*strings.Count(s[i:], "\t")
+		} else {
+			n++
+		}
+	}
+	return n
+}
+
+// endItem end line of an item, a blank line will follow nested list or hash unless Compact
+func (e *encoder) endItem() {
+	e.WriteByte('\n')
+	e.blank = e.closed && !e.opts.Compact
+	e.closed = false
+	if e.w != nil && !e.inline && e.Len() >= flushSize {
+		e.flush()
+	}
+}
+
+// flush write buffer to w, an error of w is returned by encode
+func (e *encoder) flush() {
+	if _, err := e.w.Write(e.Bytes()); err != nil {
+		panic(err)
+	}
+	e.Reset()
+}
+
+// writeBlank write the blank line which follows the last item
+func (e *encoder) writeBlank() {
+	if e.blank {
+		e.WriteByte('\n')
+		e.blank = false
+	}
+}
+
+// writeLead write the blank line and comments above item of src, prev is the item before it
+func (e *encoder) writeLead(src, prev, item *Node) {
+	if e.doc != nil && src != nil {
+		comments, blank := e.doc.between(e.doc.itemsStart(src, prev), e.doc.lineStart(item.Pos.Offset))
+		e.blank = e.blank || (blank && prev != nil)
+		e.writeBlank()
+		e.writeComments(comments)
+	}
+}
+
+// writeTail write comments after the last item of src
+func (e *encoder) writeTail(src, last *Node) {
+	if e.doc != nil && src != nil {
+		comments, blank := e.doc.between(e.doc.itemsStart(src, last), e.doc.itemsEnd(src))
+		for len(comments) > 0 && comments[len(comments)-1] == "" {
+			comments = comments[:len(comments)-1]
+		}
+		if len(comments) > 0 {
+			e.blank = e.blank || (blank && last != nil)
+			e.writeBlank()
+			e.writeComments(comments)
+		}
+	}
+}
+
+// writeComments write comment lines with #, an empty line is written as a blank line
+func (e *encoder) writeComments(comments []string) {
+	for _, c := range comments {
+		if c != "" {
+			e.indent()
+			e.WriteString(c)
+		}
+		e.WriteByte('\n')
+	}
+}
+
+// tryInline write a list or hash on one line by write if it's short or it's on one line in src,
+// return false and write nothing if it's too long or it has literals which can't be on one line
+func (e *encoder) tryInline(src *Node, write func()) bool {
+	if e.inline {
+		write()
+		return true
+	}
+
+	limit := e.opts.InlineWidth
+	if e.doc != nil && src != nil {
+		if e.doc.inline(src) {
+			limit = 0
+		} else if comments, _ := e.doc.between(e.doc.itemsStart(src, nil), e.doc.itemsEnd(src)); len(comments) > 0 {
+			return false
+		} else if limit <= 0 {
+			return false
+		}
+	} else if limit <= 0 {
+		return false
+	}
+
+	e.inline, e.at, e.failed, e.limit = true, e.Len(), false, limit
+	write()
+	failed := e.failed || e.tooLong()
+	e.inline = false
+	if failed {
+		e.Truncate(e.at)
+		return false
+	}
+
+	e.col += textWidth(string(e.Bytes()[e.at:]))
+	e.closed = false
+	return true
+}
+
+// tooLong return true if the inline list or hash being written exceeds limit
+func (e *encoder) tooLong() bool {
+	return e.limit > 0 && e.col+utf8.RuneCount(e.Bytes()[e.at:]) > e.limit
+}
+
+// writeInline write n items between open and close on one line, names are keys of hash or nil,
+// it stops once the list or hash can't be on one line
+func (e *encoder) writeInline(open, close byte, names []string, n int, item func(i int)) {
+	e.WriteByte(open)
+	for i := 0; i < n && !e.failed; i++ {
+		if i > 0 {
+			e.WriteString(", ")
+		}
+		if names != nil {
+			if b, _ := keyNeedQuote(names[i]); !b && !strings.ContainsAny(names[i], ",}") {
+				e.WriteString(names[i])
+			} else if e.writeInlineQuoted(names[i]); e.failed {
+				break
+			}
+			e.WriteString(": ")
+		}
+		item(i)
+		e.failed = e.failed || e.tooLong()
+	}
+	e.WriteByte(close)
+}
+
+// writeInlineString write s as an item of inline list or hash, quote it if need
+func (e *encoder) writeInlineString(s string) {
+	b, _ := stringNeedQuote(s)
+	if !b && !strings.ContainsAny(s, ",]}") {
+		e.WriteString(s)
+		return
+	}
+	e.writeInlineQuoted(s)
+}
+
+// writeInlineQuoted write s quoted by " or ` on one line, it fails if s has both of them or newlines
+func (e *encoder) writeInlineQuoted(s string) {
+	quote := ""
+	if !strings.Contains(s, "\"") {
+		quote = "\""
+	} else if !strings.Contains(s, "`") {
+		quote = "`"
+	}
+	if quote == "" || strings.Contains(s, "\n") {
+		e.failed = true
+		return
 	}
+	e.WriteString(quote)
+	e.WriteString(s)
+	e.WriteString(quote)
 }
 
-func (e *encoder) visitArray(v reflect.Value) {
-	//fmt.Fprintln(e, "[")
+// writeList write a list of n items, item(i) writes the ith item, src is the node of list or nil
+func (e *encoder) writeList(n int, src *Node, item func(i int)) {
+	e.implicit = false
+	if e.tryInline(src, func() { e.writeInline('[', ']', nil, n, item) }) {
+		return
+	}
 	e.WriteByte('[')
 	e.WriteByte('\n')
 	e.indentInner()
 
-	n := v.Len()
+	var prev *Node
 	for i := 0; i < n; i++ {
+		if src != nil {
+			e.writeLead(src, prev, src.List[i])
+			prev = src.List[i]
+		}
+		e.writeBlank()
 		e.indent()
-		e.visitReflectValue(v.Index(i))
-		//fmt.Fprintln(e, "")
-		e.WriteByte('\n')
+		item(i)
+		e.endItem()
 	}
+	e.writeTail(src, prev)
+	e.writeBlank()
 
 	e.indentOuter()
 	e.indent()
-	//fmt.Fprintln(e, "]")
 	e.WriteByte(']')
-	e.WriteByte('\n')
+	e.closed = true
+}
 
-	return
+// writeHash write a hash, value(i) writes value of names[i], src is the node of hash or nil
+func (e *encoder) writeHash(names []string, src *Node, value func(i int)) {
+	implicit := e.implicit
+	e.implicit = false
+	if !implicit && e.tryInline(src, func() { e.writeInline('{', '}', names, len(names), value) }) {
+		return
+	}
+	if !implicit {
+		e.WriteByte('{')
+		e.WriteByte('\n')
+		e.indentInner()
+	}
+
+	width := 0
+	if e.opts.AlignValues {
+		for _, name := range names {
+			if w := keyWidth(name); w > width {
+				width = w
+			}
+		}
+	}
+
+	var prev *Node
+	for i, name := range names {
+		if src != nil {
+			e.writeLead(src, prev, src.Hash[name])
+			prev = src.Hash[name]
+		}
+		e.writeBlank()
+		e.indent()
+		e.writeKey(name)
+		if width > 0 {
+			pad := width - keyWidth(name) + 1
+			e.WriteString(strings.Repeat(" ", pad))
+			e.col += pad
+		}
+		value(i)
+		e.endItem()
+	}
+	e.writeTail(src, prev)
+
+	if implicit {
+		e.blank = false
+		return
+	}
+	e.writeBlank()
+	e.indentOuter()
+	e.indent()
+	e.WriteByte('}')
+	e.closed = true
+}
+
+func (e *encoder) visitArray(v reflect.Value, p *typePlan) {
+	ep := p.elemPlan()
+	e.writeList(v.Len(), nil, func(i int) {
+		e.visitValue(v.Index(i), ep)
+	})
 }
 
+// stringNeedQuote return true and quote of s if s can not be written as it is.
+// quote is " or `, or a heredoc tag such as EOT if s contains both of them.
 func stringNeedQuote(s string) (b bool, quote string) {
-	if s == "" {
+	if s == "" || s == "null" {
+		return true, "\""
+	}
+	switch {
+	case s[0] < ' ', strings.IndexByte("[]{}`\"#", s[0]) >= 0, strings.HasPrefix(s, "<<"):
+	case edgeSpace(s), hasNewline(s):
+	default:
 		return false, ""
 	}
-	start := s[0]
-	if start == '[' || start == '{' || start == '`' || start == '"' || start == '\t' || start == ' ' ||
-		strings.ContainsAny(s, "\r\n") {
-		b = true
 
-		if strings.Contains(s, "\"") {
-			quote = "`"
-		} else {
-			quote = "\""
+	return true, quoteOf(s)
+}
+
+// quoteOf return " or ` to quote s, or a heredoc tag such as EOT if s contains both of them
+func quoteOf(s string) string {
+	if !strings.Contains(s, "\"") && !strings.Contains(s, "\\\n") {
+		return "\""
+	} else if !strings.Contains(s, "`") {
+		return "`"
+	}
+	return heredocTag(s)
+}
+
+// keyNeedQuote is like stringNeedQuote, but for key of hash item, which also can't have :
+func keyNeedQuote(name string) (b bool, quote string) {
+	if name == "null" {
+		return false, ""
+	}
+	if b, quote = stringNeedQuote(name); !b && strings.IndexByte(name, ':') >= 0 {
+		return true, quoteOf(name)
+	}
+	return
+}
+
+// keyWidth return columns of the last line of name written as a key
+func keyWidth(name string) int {
+	b, quote := keyNeedQuote(name)
+	switch {
+	case !b:
+		return textWidth(name)
+	case quote == "\"" || quote == "`":
+		if i := strings.LastIndexByte(name, '\n'); i >= 0 {
+			return textWidth(name[i+1:]) + 1
 		}
-		return
+		return textWidth(name) + 2
 	}
+	return len(quote)
+}
 
-	return false, ""
+// writeKey write name and : of a hash item, name is quoted if need
+func (e *encoder) writeKey(name string) {
+	b, quote := keyNeedQuote(name)
+	switch {
+	case !b:
+		e.WriteString(name)
+	case quote == "\"" || quote == "`":
+		e.WriteString(quote)
+		e.WriteString(name)
+		e.WriteString(quote)
+		if strings.IndexByte(name, '\n') >= 0 {
+			e.col = 0 // keyWidth is width of the last line
+		}
+	default:
+		e.WriteString("<<")
+		e.WriteString(quote)
+		e.WriteByte('\n')
+		e.WriteString(name)
+		e.WriteByte('\n')
+		e.indent() // col is set to the line of tag
+		e.WriteString(quote)
+	}
+	e.WriteByte(':')
+	e.col += keyWidth(name) + 1
 }
 
-// TODO: adjust indent algorithm
-func (e *encoder) visitReflectValue(v reflect.Value) {
+// edgeSpace return true if s starts or ends with a unicode space, s is not empty
+func edgeSpace(s string) bool {
+	first, last := rune(s[0]), rune(s[len(s)-1])
+	if first >= utf8.RuneSelf {
+		first, _ = utf8.DecodeRuneInString(s)
+	}
+	if last >= utf8.RuneSelf {
+		last, _ = utf8.DecodeLastRuneInString(s)
+	}
+	return unicode.IsSpace(first) || unicode.IsSpace(last)
+}
+
+// hasNewline return true if s contains \r or \n
+func hasNewline(s string) bool {
+	for i := 0; i < len(s); i++ {
+		if s[i] == '\n' || s[i] == '\r' {
+			return true
+		}
+	}
+	return false
+}
+
+// heredocTag return a tag which is not in s, such as EOT, EOT1, EOT2
+func heredocTag(s string) string {
+	tag := "EOT"
+	for i := 1; strings.Contains(s, tag); i++ {
+		tag = "EOT" + strconv.Itoa(i)
+	}
+	return tag
+}
+
+// writeString write s as a literal, quote it if need
+func (e *encoder) writeString(s string) {
+	if e.inline {
+		e.writeInlineString(s)
+	} else if e.opts.LineWidth > 0 && e.col+len(s) > e.opts.LineWidth && canWrap(s) {
+		e.writeWrapped(s)
+	} else if b, quote := stringNeedQuote(s); !b {
+		e.WriteString(s)
+	} else if quote == "\"" || quote == "`" {
+		e.WriteString(quote)
+		e.WriteString(s)
+		e.WriteString(quote)
+	} else {
+		e.WriteString("<<")
+		e.WriteString(quote)
+		e.WriteByte('\n')
+		e.WriteString(s)
+		e.WriteByte('\n')
+		e.indent()
+		e.WriteString(quote)
+	}
+}
+
+// canWrap return true if s can be written as quoted lines end with \
+func canWrap(s string) bool {
+	return !strings.ContainsAny(s, "\r\n\"\\")
+}
+
+// writeWrapped write s as quoted lines, each line but the last ends with \,
+// next lines are indented one more level, the \, newline and indent are removed when parse.
+func (e *encoder) writeWrapped(s string) {
+	const minWidth = 16
+
+	e.WriteByte('"')
+	width := e.opts.LineWidth - e.col - 2 // quote and \
+	e.indentInner()
+	for {
+		if width < minWidth {
+			width = minWidth
+		}
+		if len(s) <= width {
+			break
+		}
+
+		i := wrapIndex(s, width)
+		if i == 0 {
+			break
+		}
+		e.WriteString(s[:i])
+		e.WriteString("\\\n")
+		e.indent()
+		s = s[i:]
+		width = e.opts.LineWidth - e.col - 1
+	}
+	e.indentOuter()
+	e.WriteString(s)
+	e.WriteByte('"')
+}
 
+// wrapIndex return where to break s before width, 0 if s can not be broken.
+// the next line can not start with space or tab, they are trimmed when parse.
+func wrapIndex(s string, width int) int {
+	for i := width; i > 0; i-- {
+		if s[i] != ' ' && s[i] != '\t' && s[i-1] == ' ' {
+			return i
+		}
+	}
+	for i := width; i > 0; i-- {
+		if s[i] != ' ' && s[i] != '\t' && utf8.RuneStart(s[i]) {
+			return i
+		}
+	}
+	return 0
+}
+
+func (e *encoder) visitNode(n *Node) {
+	switch n.Type {
+	case NodeNull:
+		e.WriteString("null")
+	case NodeLiteral:
+		e.writeString(n.Literal)
+	case NodeList:
+		e.writeList(len(n.List), n, func(i int) {
+			e.visitNode(n.List[i])
+		})
+	case NodeHash:
+		names := n.orderedKeys()
+		e.writeHash(names, n, func(i int) {
+			e.visitNode(n.Hash[names[i]])
+		})
+	}
+}
+
+func (e *encoder) visitReflectValue(v reflect.Value) {
 	if !v.IsValid() {
-		e.WriteString("")
+		e.WriteString("null")
+		return
+	}
+	e.visitValue(v, planOf(v.Type()))
+}
+
+// visitValue write v, p is plan of type of v
+func (e *encoder) visitValue(v reflect.Value, p *typePlan) {
+
+	if p.time {
+		if t := reflect.Indirect(v); t.IsValid() && t.CanInterface() {
+			layout := e.opts.TimeLayout
+			if layout == "" {
+				layout = time.RFC3339Nano
+			}
+			e.writeString(t.Interface().(time.Time).Format(layout))
+			return
+		}
 	}
 
-	//v = gotype.Underlying(v)
-	kind := v.Kind()
+	if p.marshaler || (p.ptrMarshaler && v.CanAddr()) {
+		if m, tm := marshaler(v); m != nil {
+			node, err := m.MarshalKSON()
+			if err != nil {
+				panic(err)
+			}
+			if node != nil {
+				e.visitNode(node)
+			}
+			return
+		} else if tm != nil {
+			text, err := tm.MarshalText()
+			if err != nil {
+				panic(err)
+			}
+			e.writeString(string(text))
+			return
+		}
+	}
+
+	kind := p.kind
 	switch kind {
 	case reflect.Bool,
 		reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
@@ -93,103 +600,96 @@ func (e *encoder) visitReflectValue(v reflect.Value) {
 		reflect.Float32, reflect.Float64:
 		e.WriteString(gotype.Value(v).Format())
 	case reflect.String:
-		s := v.String()
-		if b, quote := stringNeedQuote(s); b {
-			e.WriteString(quote)
-			e.WriteString(s)
-			e.WriteString(quote)
-			//e.WriteString("\n")
-		} else {
-			e.WriteString(s)
-		}
+		e.writeString(v.String())
 	case reflect.Struct:
-		//fmt.Fprintln(e, "{")
-		e.WriteByte('{')
-		e.WriteByte('\n')
-		e.indentInner()
-
-		typ := v.Type()
-		count := typ.NumField()
-		for i := 0; i < count; i++ {
-			f := typ.Field(i)
+		if p.direct {
+			e.writeHash(p.names, nil, func(i int) {
+				fv, _ := fieldByIndex(v, p.fields[i].index, false)
+				e.visitValue(fv, p.fieldPlan(i))
+			})
+			break
+		}
 
-			if f.PkgPath != "" {
+		// most structs have a few fields, so names and values are on stack
+		var nameBuf [16]string
+		var valueBuf [16]fieldValue
+		names, values := nameBuf[:0], valueBuf[:0]
+		for i, f := range p.fields {
+			fv, ok := fieldByIndex(v, f.index, false)
+			if !ok {
 				continue
 			}
-
-			e.indent()
-			//fmt.Fprint(e, f.Name)
-			e.WriteString(f.Name)
-			//fmt.Fprint(e, ":") 
-			e.WriteByte(':')
-			e.visitReflectValue(v.Field(i))
-			//fmt.Fprintln(e, "")
-			e.WriteByte('\n')
+			if f.omitEmpty && gotype.Value(fv).IsEmptyValue() {
+				continue
+			}
+			names = append(names, f.name)
+			values = append(values, fieldValue{fv, p.fieldPlan(i)})
 		}
 
-		e.indentOuter()
-		e.indent()
-		//fmt.Fprintln(e, "}")
-		e.WriteByte('}')
-		e.WriteByte('\n')
+		e.writeHash(names, nil, func(i int) {
+			e.visitValue(values[i].v, values[i].p)
+		})
 	case reflect.Map:
-		if !gotype.IsSimple(v.Type().Key().Kind()) {
+		keyKind := p.typ.Key().Kind()
+		if !gotype.IsSimple(keyKind) && !p.textKey {
 			return
 		}
 
 		if v.IsNil() {
-			//fmt.Fprint(e, "") //fmt.Fprint(e, "null")
-			e.WriteByte(' ')
+			e.WriteString("null")
 			break
 		}
 
-		//fmt.Fprintln(e, "{")
-		e.WriteByte('{')
-		e.WriteByte('\n')
-		e.indentInner()
-
 		keys := v.MapKeys()
-		for _, k := range keys {
-			e.indent()
-			//fmt.Fprint(e, k)
-			e.WriteString(k.String())
-			//fmt.Fprint(e, ":") 
-			e.WriteByte(':')
-			e.visitReflectValue(v.MapIndex(k))
-			//fmt.Fprintln(e, "") 
-			e.WriteByte('\n')
-		}
-		e.indentOuter()
-		e.indent()
-		//fmt.Fprintln(e, "}")
-		e.WriteByte('}')
-		e.WriteByte('\n')
+		names := make([]string, len(keys))
+		for i, k := range keys {
+			names[i] = formatMapKey(k)
+		}
+		if e.opts.SortKeys {
+			numeric := gotype.IsNumeric(keyKind) && !p.textKey
+			sort.Sort(byName{names, keys, numeric})
+		}
+
+		ep := p.elemPlan()
+		e.writeHash(names, nil, func(i int) {
+			e.visitValue(v.MapIndex(keys[i]), ep)
+		})
 	case reflect.Slice:
 
 		if v.IsNil() {
-			//fmt.Fprint(e, "") //fmt.Fprint(e, "null")
-			e.WriteByte(' ')
+			e.WriteString("null")
 			break
 		}
-		e.visitArray(v)
+		e.visitArray(v, p)
 	case reflect.Array:
-		e.visitArray(v)
-	case reflect.Interface, reflect.Ptr:
-		if v.IsNil() || !v.IsValid() {
-			//fmt.Fprint(e, "") //fmt.Fprint(e, "null")
-			e.WriteByte(' ')
+		e.visitArray(v, p)
+	case reflect.Interface:
+		if v.IsNil() {
+			e.WriteString("null")
 			return
 		}
 		e.visitReflectValue(v.Elem())
+	case reflect.Ptr:
+		if v.IsNil() {
+			e.WriteString("null")
+			return
+		}
+		e.visitValue(v.Elem(), p.elemPlan())
 	default:
-		fmt.Fprint(e, v.Interface())
+		fmt.Fprint(e.Buffer, v.Interface())
 		//return errors.New("Unsupported type " + v.Type().String())
 	}
 	return
 }
 
-// Marshal returns the kson encoding of v.
-func Marshal(a interface{}) (data []byte, err error) {
+// fieldValue is value of a struct field and its plan
+type fieldValue struct {
+	v reflect.Value
+	p *typePlan
+}
+
+// encode write kson encoding of a to e
+func (e *encoder) encode(a interface{}) (err error) {
 
 	defer func() {
 		if r := recover(); r != nil {
@@ -204,11 +704,99 @@ func Marshal(a interface{}) (data []byte, err error) {
 		}
 	}()
 
-	encoder := &encoder{}
-	encoder.visitReflectValue(reflect.ValueOf(a))
+	e.visitReflectValue(reflect.ValueOf(a))
+	return
+}
+
+// formatMapKey return name of hash item for key k of map
+func formatMapKey(k reflect.Value) string {
+	if tm, ok := k.Interface().(encoding.TextMarshaler); ok {
+		text, err := tm.MarshalText()
+		if err != nil {
+			panic(err)
+		}
+		return string(text)
+	}
+	if k.Kind() == reflect.String {
+		return k.String()
+	}
+	return gotype.Value(k).Format()
+}
+
+// byName sort keys of map by names, or by values if keys are numbers
+type byName struct {
+	names   []string
+	keys    []reflect.Value
+	numeric bool
+}
+
+func (a byName) Len() int { return len(a.names) }
+func (a byName) Less(i, j int) bool {
+	if a.numeric {
+		x, y := a.keys[i], a.keys[j]
+		switch {
+		case gotype.IsInt(x.Kind()):
+			return x.Int() < y.Int()
+		case gotype.IsUint(x.Kind()):
+			return x.Uint() < y.Uint()
+		case gotype.IsFloat(x.Kind()):
+			return x.Float() < y.Float()
+		}
+	}
+	return a.names[i] < a.names[j]
+}
+func (a byName) Swap(i, j int) {
+	a.names[i], a.names[j] = a.names[j], a.names[i]
+	a.keys[i], a.keys[j] = a.keys[j], a.keys[i]
+}
+
+// bufferPool keeps buffers of Marshal, output is copied out of them, so a Marshal allocates it once
+var bufferPool = sync.Pool{
+	New: func() interface{} {
+		return new(bytes.Buffer)
+	},
+}
+
+// putBuffer put buf back to pool unless it's too large to keep
+func putBuffer(buf *bytes.Buffer) {
+	if buf.Cap() <= 64<<10 {
+		buf.Reset()
+		bufferPool.Put(buf)
+	}
+}
+
+// Marshal returns the kson encoding of v.
+func Marshal(a interface{}) (data []byte, err error) {
+
+	buf := bufferPool.Get().(*bytes.Buffer)
+	defer putBuffer(buf)
+	encoder := &encoder{Buffer: buf}
+	err = encoder.encode(a)
 	if err != nil {
 		return nil, err
 	}
-	return encoder.Bytes(), nil
+	if encoder.closed {
+		buf.WriteByte('\n')
+	}
+	return append([]byte(nil), buf.Bytes()...), nil
 
 }
+
+// MarshalIndent is like Marshal, but each level is indented by indent, keys of maps are sorted and output ends with a newline.
+func MarshalIndent(a interface{}, indent string) ([]byte, error) {
+	return MarshalOptions(a, EncoderOptions{Indent: indent, SortKeys: true, TrailingNewline: true})
+}
+
+// MarshalOptions returns the kson encoding of v in format of opts.
+func MarshalOptions(a interface{}, opts EncoderOptions) ([]byte, error) {
+	buf := bufferPool.Get().(*bytes.Buffer)
+	defer putBuffer(buf)
+	e := &encoder{Buffer: buf, opts: opts, implicit: opts.Implicit}
+	if err := e.encode(a); err != nil {
+		return nil, err
+	}
+	if opts.TrailingNewline && !(opts.Implicit && bytes.HasSuffix(buf.Bytes(), []byte{'\n'})) {
+		buf.WriteByte('\n')
+	}
+	return append([]byte(nil), buf.Bytes()...), nil
+}
@@ -4,8 +4,11 @@
 package kson_test
 
 import (
+	"bytes"
 	"github.com/sdming/kiss/kson"
+	"github.com/sdming/kiss/ktest"
 	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -199,3 +202,276 @@ func TestMarshalHash(t *testing.T) {
 	}
 
 }
+
+type Format struct {
+	Name string
+	Port int
+	M    map[string]int
+	L    []string
+}
+
+var formatData = Format{
+	Name: "a",
+	Port: 80,
+	M:    map[string]int{"b": 2, "a": 1, "ccc": 3},
+	L:    []string{"x", "y"},
+}
+
+func TestMarshalIndent(t *testing.T) {
+	b, err := kson.MarshalIndent(formatData, "  ")
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ktest.Equal(t, "MarshalIndent", "{\n  Name:a\n  Port:80\n  M:{\n    a:1\n    b:2\n    ccc:3\n  }\n\n  L:[\n    x\n    y\n  ]\n\n}\n", string(b))
+}
+
+func TestMarshalOptions(t *testing.T) {
+	b, err := kson.MarshalOptions(formatData, kson.EncoderOptions{SortKeys: true, AlignValues: true, Compact: true})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ktest.Equal(t, "AlignValues and Compact", "{\n\tName: a\n\tPort: 80\n\tM:    {\n\t\ta:   1\n\t\tb:   2\n\t\tccc: 3\n\t}\n\tL:    [\n\t\tx\n\t\ty\n\t]\n}", string(b))
+
+	var p Format
+	if err = kson.Unmarshal(b, &p); err != nil {
+		t.Error(err)
+		return
+	}
+	ktest.Equal(t, "AlignValues unmarshal Name", formatData.Name, p.Name)
+	ktest.Equal(t, "AlignValues unmarshal Port", formatData.Port, p.Port)
+	ktest.Equal(t, "AlignValues unmarshal M", 3, p.M["ccc"])
+	ktest.Equal(t, "AlignValues unmarshal L", "y", p.L[1])
+
+	text := "the quick brown fox jumps over the lazy dog again and again"
+	b, err = kson.MarshalOptions(map[string]string{"t": text}, kson.EncoderOptions{LineWidth: 30})
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ktest.Equal(t, "LineWidth", "{\n\tt:\"the quick brown \\\n\t\tfox jumps over \\\n\t\tthe lazy dog \\\n\t\tagain and again\"\n}", string(b))
+
+	var m map[string]string
+	if err = kson.Unmarshal(b, &m); err != nil {
+		t.Error(err)
+		return
+	}
+	ktest.Equal(t, "LineWidth unmarshal", text, m["t"])
+}
+
+func TestEncoderSetOptions(t *testing.T) {
+	var buf bytes.Buffer
+	enc := kson.NewEncoder(&buf)
+	enc.SetOptions(kson.EncoderOptions{Indent: " ", SortKeys: true, Compact: true})
+	if err := enc.Encode(map[string]int{"b": 2, "a": 1}); err != nil {
+		t.Error(err)
+		return
+	}
+	ktest.Equal(t, "SetOptions", "{\n a:1\n b:2\n}\n", buf.String())
+}
+
+var quoteData = []string{
+	"",
+	" ",
+	"plain",
+	" leading space",
+	"trailing space ",
+	"\ttab",
+	"#not comment",
+	"[",
+	"]",
+	"{}",
+	"<<EOT",
+	"a\nb",
+	"a\r\nb\r",
+	`say "hi"`,
+	"`raw`",
+	"both \" and `",
+	"both \" and `\nEOT\n",
+	"\"\nline continue\\\n`",
+	"\\",
+	"\u00a0nbsp",
+	"\x00",
+	"null",
+}
+
+func testQuote(t *testing.T, s string, opts kson.EncoderOptions) {
+	data := struct {
+		S string
+		L []string
+	}{S: s, L: []string{s, s}}
+
+	b, err := kson.MarshalOptions(data, opts)
+	if err != nil {
+		t.Errorf("marshal %q error %v", s, err)
+		return
+	}
+
+	data.S, data.L = "", nil
+	if err = kson.Unmarshal(b, &data); err != nil {
+		t.Errorf("unmarshal %q error %v\n%s", s, err, b)
+		return
+	}
+	if data.S != s || len(data.L) != 2 || data.L[0] != s || data.L[1] != s {
+		t.Errorf("round trip of %q fail: %q %q\n%s", s, data.S, data.L, b)
+	}
+
+	b, err = kson.Marshal(s)
+	if err != nil {
+		t.Errorf("marshal %q error %v", s, err)
+		return
+	}
+	node, err := kson.Parse(b)
+	if err != nil {
+		t.Errorf("parse %q error %v\n%s", s, err, b)
+		return
+	}
+	if node.Literal != s {
+		t.Errorf("round trip of literal %q fail: %q\n%s", s, node.Literal, b)
+	}
+}
+
+// testQuoteKey marshal s as a key of map and hash, unmarshal should return the same key
+func testQuoteKey(t *testing.T, s string, opts kson.EncoderOptions) {
+	data := struct {
+		M map[string]string
+		L []map[string]int
+	}{M: map[string]string{s: s}, L: []map[string]int{{s: 1}}}
+
+	b, err := kson.MarshalOptions(data, opts)
+	if err != nil {
+		t.Errorf("marshal key %q error %v", s, err)
+		return
+	}
+
+	data.M, data.L = nil, nil
+	if err = kson.Unmarshal(b, &data); err != nil {
+		t.Errorf("unmarshal key %q error %v\n%s", s, err, b)
+		return
+	}
+	if len(data.M) != 1 || data.M[s] != s || len(data.L) != 1 || data.L[0][s] != 1 {
+		t.Errorf("round trip of key %q fail: %q %v\n%s", s, data.M, data.L, b)
+	}
+}
+
+func TestMarshalQuote(t *testing.T) {
+	for _, s := range quoteData {
+		testQuote(t, s, kson.EncoderOptions{})
+		testQuote(t, s, kson.EncoderOptions{LineWidth: 20})
+		testQuote(t, s, kson.EncoderOptions{InlineWidth: 80})
+	}
+}
+
+func TestMarshalQuoteKey(t *testing.T) {
+	for _, s := range append(quoteData, "}", "a:b", " x", "a: b", "\"x\": y") {
+		testQuoteKey(t, s, kson.EncoderOptions{})
+		testQuoteKey(t, s, kson.EncoderOptions{InlineWidth: 80})
+		testQuoteKey(t, s, kson.EncoderOptions{AlignValues: true, SortKeys: true})
+	}
+}
+
+func TestHeredoc(t *testing.T) {
+	node, err := kson.Parse([]byte("{\n\ta:\t<<END\n\"x\" `y`\n  END  \n\tb:\t<<END\n\tEND\n\tc:\t<<END x\n}\n"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ktest.Equal(t, "heredoc", "\"x\" `y`", node.ChildString("a"))
+	ktest.Equal(t, "empty heredoc", "", node.ChildString("b"))
+	ktest.Equal(t, "not heredoc", "<<END x", node.ChildString("c"))
+
+	_, err = kson.Parse([]byte("{\n\ta:\t<<END\n\tx\n}\n"))
+	if err == nil {
+		t.Error("heredoc should be closed")
+	}
+}
+
+// TestQuoteCompatibility shows inputs which mean something else since heredoc and wrapped lines,
+// and how to write the old meaning
+func TestQuoteCompatibility(t *testing.T) {
+	node, err := kson.Parse([]byte("{\n\tShift:\t<<EOT\n\tx\n\tEOT\n\tQuoted:\t\"<<EOT\"\n\tSpace:\t<< EOT\n}\n"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ktest.Equal(t, "heredoc", "\tx", node.ChildString("Shift"))
+	ktest.Equal(t, "quoted is literal", "<<EOT", node.ChildString("Quoted"))
+	ktest.Equal(t, "not a tag", "<< EOT", node.ChildString("Space"))
+
+	// used to be the literal <<EOT, the heredoc is not closed now
+	if _, err = kson.Parse([]byte("{\n\tShift:\t<<EOT\n\tNext:\tx\n}\n")); err == nil {
+		t.Error("heredoc should be closed")
+	}
+
+	node, err = kson.Parse([]byte("{\n\tJoined:\t\"one \\\n\t\ttwo\"\n\tKept:\t`one \\\n\t\ttwo`\n}\n"))
+	if err != nil {
+		t.Error(err)
+		return
+	}
+	ktest.Equal(t, "backslash newline in \" is joined", "one two", node.ChildString("Joined"))
+	ktest.Equal(t, "backslash newline in ` is kept", "one \\\n\t\ttwo", node.ChildString("Kept"))
+}
+
+func FuzzMarshalString(f *testing.F) {
+	for _, s := range quoteData {
+		f.Add(s)
+	}
+	f.Fuzz(func(t *testing.T, s string) {
+		testQuote(t, s, kson.EncoderOptions{})
+		testQuote(t, s, kson.EncoderOptions{LineWidth: 20})
+		testQuote(t, s, kson.EncoderOptions{InlineWidth: 80})
+		testQuoteKey(t, s, kson.EncoderOptions{})
+		testQuoteKey(t, s, kson.EncoderOptions{InlineWidth: 80})
+	})
+}
+
+type InlineConfig struct {
+	Name    string
+	Browser []string
+	Empty   []string
+	Db      map[string]int
+	Quoted  []string
+	Lines   []string
+	Roles   []Backend
+	Long    []string
+}
+
+func TestMarshalInline(t *testing.T) {
+	c := InlineConfig{
+		Name:    "app",
+		Browser: []string{"ie", "chrome", "firefox"},
+		Empty:   []string{},
+		Db:      map[string]int{"port": 3306, "pool": 8},
+		Quoted:  []string{"a, b", `say "hi"`, "]", "", "null"},
+		Lines:   []string{"a", "b\nc"},
+		Roles:   []Backend{{"a", 1}, {"b", 2}},
+		Long:    []string{strings.Repeat("x", 30), strings.Repeat("y", 30), strings.Repeat("z", 30)},
+	}
+	b, err := kson.MarshalOptions(c, kson.EncoderOptions{InlineWidth: 80, SortKeys: true, Compact: true})
+	if err != nil {
+		t.Error("marshal error", err)
+		return
+	}
+	expect := "{\n\tName:app\n\tBrowser:[ie, chrome, firefox]\n\tEmpty:[]\n\tDb:{pool: 8, port: 3306}\n" +
+		"\tQuoted:[\"a, b\", say \"hi\", \"]\", \"\", \"null\"]\n" +
+		"\tLines:[\n\t\ta\n\t\t\"b\nc\"\n\t]\n" +
+		"\tRoles:[{Host: a, Weight: 1}, {Host: b, Weight: 2}]\n" +
+		"\tLong:[\n\t\t" + c.Long[0] + "\n\t\t" + c.Long[1] + "\n\t\t" + c.Long[2] + "\n\t]\n}"
+	ktest.Equal(t, "inline", expect, string(b))
+
+	var p InlineConfig
+	if err := kson.UnmarshalStrict(b, &p); err != nil {
+		t.Error("unmarshal error", err)
+		return
+	}
+	ktest.Equal(t, "browser", strings.Join(c.Browser, "|"), strings.Join(p.Browser, "|"))
+	ktest.Equal(t, "empty", 0, len(p.Empty))
+	ktest.Equal(t, "db", 3306, p.Db["port"])
+	ktest.Equal(t, "quoted", strings.Join(c.Quoted, "|"), strings.Join(p.Quoted, "|"))
+	ktest.Equal(t, "lines", strings.Join(c.Lines, "|"), strings.Join(p.Lines, "|"))
+	ktest.Equal(t, "roles", "b", p.Roles[1].Host)
+
+	b, _ = kson.MarshalOptions(c.Browser, kson.EncoderOptions{})
+	ktest.Equal(t, "not inline by default", "[\n\tie\n\tchrome\n\tfirefox\n]", string(b))
+}
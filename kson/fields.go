@@ -0,0 +1,185 @@
+// Copyright 2012 by sdm. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package kson
+
+import (
+	"reflect"
+	"strings"
+)
+
+// field is a struct field to encode or decode
+type field struct {
+	name      string // key in hash
+	tagged    bool   // name is given by tag
+	index     []int  // index sequence of field, more than one if field is inlined
+	typ       reflect.Type
+	omitEmpty bool
+	required  bool // key is required by SchemaOf
+
+	appendSlices  bool // lists are appended to slices in the field when decode
+	replaceSlices bool // lists replace slices in the field when decode
+}
+
+// tagOptions is the string following a comma in a struct field's "kson" tag
+type tagOptions string
+
+// parseTag split kson tag into name and options
+func parseTag(tag string) (string, tagOptions) {
+	if i := strings.Index(tag, ","); i >= 0 {
+		return tag[:i], tagOptions(tag[i+1:])
+	}
+	return tag, tagOptions("")
+}
+
+// Contains return true if opt is one of options
+func (o tagOptions) Contains(opt string) bool {
+	s := string(o)
+	for s != "" {
+		var next string
+		if i := strings.Index(s, ","); i >= 0 {
+			s, next = s[:i], s[i+1:]
+		}
+		if s == opt {
+			return true
+		}
+		s = next
+	}
+	return false
+}
+
+// typeFields return fields of struct type t. like encoding/json, fields of embedded structs and pointers to them
+// are promoted to t unless the tag gives them a name, the shallowest field of a name hides deeper ones,
+// a tagged one wins if there are several at the same depth, otherwise all of them are dropped.
+// supported tags:
+//
+//	Field int `kson:"name"`           // key is "name"
+//	Field int `kson:"name,omitempty"` // skip field if it's empty value when encode
+//	Field int `kson:"name,required"`  // key is required by SchemaOf
+//	Hosts []string `kson:",append"`   // list is appended to existing slice when decode, replace is the opposite
+//	Field int `kson:"-"`              // skip field
+//	Common    `kson:"common"`         // embedded struct is a hash named common
+//	Db   Db   `kson:",inline"`        // fields of a named struct field are read from and written to parent hash
+func typeFields(t reflect.Type) []field {
+	fields := make([]field, 0, t.NumField())
+	appendFields(t, nil, &fields, map[reflect.Type]bool{t: true})
+
+	result := make([]field, 0, len(fields))
+	for _, f := range fields {
+		if x, ok := dominantField(fields, f.name); ok && sameIndex(x.index, f.index) {
+			result = append(result, f)
+		}
+	}
+	return result
+}
+
+// dominantField return the field of name which hides others, fields are in order of index
+func dominantField(fields []field, name string) (field, bool) {
+	var found field
+	depth, count, tagged := -1, 0, 0
+	for _, f := range fields {
+		switch {
+		case f.name != name:
+		case depth < 0 || len(f.index) < depth:
+			depth, count, tagged, found = len(f.index), 1, 0, f
+			if f.tagged {
+				tagged = 1
+			}
+		case len(f.index) == depth:
+			count++
+			if f.tagged {
+				if tagged == 0 {
+					found = f
+				}
+				tagged++
+			}
+		}
+	}
+	if count == 1 || tagged == 1 {
+		return found, true
+	}
+	return field{}, false
+}
+
+func sameIndex(a, b []int) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// appendFields append fields of t to fields, visited are struct types on the path which are not promoted again
+func appendFields(t reflect.Type, index []int, fields *[]field, visited map[reflect.Type]bool) {
+	count := t.NumField()
+	for i := 0; i < count; i++ {
+		f := t.Field(i)
+
+		tag := f.Tag.Get("kson")
+		if tag == "-" {
+			continue
+		}
+		name, opts := parseTag(tag)
+
+		ft := f.Type
+		if ft.Kind() == reflect.Ptr {
+			ft = ft.Elem()
+		}
+		promote := ft.Kind() == reflect.Struct && ((f.Anonymous && name == "") || opts.Contains("inline"))
+
+		// fields of an unexported embedded struct are promoted
+		if f.PkgPath != "" && !(promote && f.Anonymous) {
+			continue
+		}
+
+		fieldIndex := make([]int, len(index)+1)
+		copy(fieldIndex, index)
+		fieldIndex[len(index)] = i
+
+		if promote {
+			if !visited[ft] {
+				visited[ft] = true
+				appendFields(ft, fieldIndex, fields, visited)
+				delete(visited, ft)
+			}
+			continue
+		}
+
+		tagged := name != ""
+		if name == "" {
+			name = f.Name
+		}
+		*fields = append(*fields, field{
+			name:      name,
+			tagged:    tagged,
+			index:     fieldIndex,
+			typ:       f.Type,
+			omitEmpty: opts.Contains("omitempty"),
+			required:  opts.Contains("required"),
+
+			appendSlices:  opts.Contains("append"),
+			replaceSlices: opts.Contains("replace"),
+		})
+	}
+}
+
+// fieldByIndex return nested field of struct v, nil pointer of inline struct is allocated if alloc is true
+func fieldByIndex(v reflect.Value, index []int, alloc bool) (reflect.Value, bool) {
+	for i, x := range index {
+		if i > 0 && v.Kind() == reflect.Ptr {
+			if v.IsNil() {
+				if !alloc || !v.CanSet() {
+					return reflect.Value{}, false
+				}
+				v.Set(reflect.New(v.Type().Elem()))
+			}
+			v = v.Elem()
+		}
+		v = v.Field(x)
+	}
+	return v, true
+}
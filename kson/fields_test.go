@@ -0,0 +1,223 @@
+// Copyright 2012 by sdm. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package kson_test
+
+import (
+	"github.com/sdming/kiss/kson"
+	"github.com/sdming/kiss/ktest"
+	"strings"
+	"testing"
+)
+
+type TagCommon struct {
+	Version string `kson:"version"`
+	Debug   bool   `kson:"debug,omitempty"`
+}
+
+type TagExtra struct {
+	Owner string `kson:"owner"`
+}
+
+type TagConfig struct {
+	TagCommon `kson:",inline"`
+	*TagExtra `kson:",inline"`
+	LogLevel  string `kson:"log_level"`
+	DbLog     Db     `kson:"Db_Log"`
+	Secret    string `kson:"-"`
+	Comment   string `kson:",omitempty"`
+	Port      int    `kson:"port,omitempty"`
+	Tags      []string
+}
+
+func TestMarshalTag(t *testing.T) {
+	c := TagConfig{
+		TagCommon: TagCommon{Version: "1.0"},
+		LogLevel:  "debug",
+		DbLog:     Db{Host: "127.0.0.1"},
+		Secret:    "secret",
+		Port:      8000,
+	}
+
+	b, err := kson.Marshal(c)
+	if err != nil {
+		t.Error("marshal error", err)
+		return
+	}
+	s := string(b)
+	t.Log(s)
+
+	for _, key := range []string{"version:", "log_level:", "Db_Log:", "port:", "Tags:"} {
+		if !strings.Contains(s, "\t"+key) {
+			t.Errorf("marshal should contain key %s", key)
+		}
+	}
+	for _, key := range []string{"Secret:", "Comment:", "debug:", "owner:", "TagCommon:", "LogLevel:"} {
+		if strings.Contains(s, key) {
+			t.Errorf("marshal should not contain key %s", key)
+		}
+	}
+}
+
+func TestUnmarshalTag(t *testing.T) {
+	data := `
+	{
+		version:	2.0
+		debug:		true
+		owner:		ops
+		log_level:	info
+		Db_Log:	{
+			Host:	db.local
+		}
+		Secret:		secret
+		port:		9000
+		Tags:	[
+			a
+		]
+	}
+	`
+
+	var c TagConfig
+	if err := kson.Unmarshal([]byte(data), &c); err != nil {
+		t.Error("unmarshal error", err)
+		return
+	}
+
+	ktest.Equal(t, "version", "2.0", c.Version)
+	ktest.Equal(t, "debug", true, c.Debug)
+	ktest.Equal(t, "log_level", "info", c.LogLevel)
+	ktest.Equal(t, "Db_Log", "db.local", c.DbLog.Host)
+	ktest.Equal(t, "Secret", "", c.Secret)
+	ktest.Equal(t, "port", 9000, c.Port)
+	ktest.Equal(t, "Tags", 1, len(c.Tags))
+	if c.TagExtra == nil {
+		t.Error("inline pointer should be allocated")
+	} else {
+		ktest.Equal(t, "owner", "ops", c.Owner)
+	}
+}
+
+type EmbedBase struct {
+	Name  string
+	Port  int
+	Level string
+}
+
+type EmbedLevel struct {
+	Level string `kson:"Level"`
+	Zone  string
+}
+
+type embedHidden struct {
+	Region string
+}
+
+type EmbedLoop struct {
+	*EmbedLoop
+	Value string
+}
+
+type EmbedConfig struct {
+	EmbedBase
+	EmbedLevel
+	*TagExtra
+	embedHidden
+	TagCommon `kson:"common"`
+	Port      int
+	Loop      EmbedLoop
+}
+
+func TestEmbedded(t *testing.T) {
+	data := `
+	{
+		Name:	app
+		Port:	9000
+		Level:	debug
+		Zone:	east
+		owner:	ops
+		Region:	cn
+		common:	{
+			version:	1.0
+		}
+		Loop:	{
+			Value:	x
+		}
+	}
+	`
+
+	var c EmbedConfig
+	if err := kson.UnmarshalStrict([]byte(data), &c); err != nil {
+		t.Error("unmarshal error", err)
+		return
+	}
+
+	ktest.Equal(t, "Name", "app", c.Name)
+	ktest.Equal(t, "Port", 9000, c.Port)
+	ktest.Equal(t, "EmbedBase.Port", 0, c.EmbedBase.Port)
+	ktest.Equal(t, "tagged Level", "debug", c.EmbedLevel.Level)
+	ktest.Equal(t, "EmbedBase.Level", "", c.EmbedBase.Level)
+	ktest.Equal(t, "Zone", "east", c.Zone)
+	ktest.Equal(t, "Region", "cn", c.Region)
+	ktest.Equal(t, "common", "1.0", c.Version)
+	ktest.Equal(t, "Loop", "x", c.Loop.Value)
+	if c.TagExtra == nil {
+		t.Error("embedded pointer should be allocated")
+	} else {
+		ktest.Equal(t, "owner", "ops", c.Owner)
+	}
+
+	b, err := kson.MarshalIndent(c, "\t")
+	if err != nil {
+		t.Error("marshal error", err)
+		return
+	}
+	s := string(b)
+	for _, key := range []string{"\nName:", "\nLevel:debug", "\nRegion:", "\nowner:", "\ncommon:", "\nPort:9000"} {
+		if !strings.Contains("\n"+strings.Replace(s, "\t", "", -1), key) {
+			t.Errorf("marshal should contain %s: %s", key, s)
+		}
+	}
+	for _, key := range []string{"EmbedBase", "EmbedLevel", "TagExtra", "embedHidden", "EmbedLoop"} {
+		if strings.Contains(s, key) {
+			t.Errorf("marshal should not contain %s: %s", key, s)
+		}
+	}
+
+	var back EmbedConfig
+	if err = kson.UnmarshalStrict(b, &back); err != nil {
+		t.Error("unmarshal marshaled error", err)
+		return
+	}
+	ktest.Equal(t, "round trip", c.Name+c.EmbedLevel.Level+c.Region+c.Owner, back.Name+back.EmbedLevel.Level+back.Region+back.Owner)
+}
+
+type TreeNode struct {
+	Name     string
+	Children []*TreeNode
+	Parent   *TreeNode `kson:"-"`
+}
+
+func TestRecursiveType(t *testing.T) {
+	tree := &TreeNode{Name: "root", Children: []*TreeNode{{Name: "a"}, {Name: "b", Children: []*TreeNode{{Name: "b1"}}}}}
+
+	// plans of types are built once and shared by goroutines
+	done := make(chan string)
+	for i := 0; i < 4; i++ {
+		go func() {
+			b, err := kson.Marshal(tree)
+			if err != nil {
+				done <- err.Error()
+				return
+			}
+			var back TreeNode
+			if err = kson.UnmarshalStrict(b, &back); err != nil {
+				done <- err.Error()
+				return
+			}
+			done <- back.Children[1].Children[0].Name
+		}()
+	}
+	for i := 0; i < 4; i++ {
+		ktest.Equal(t, "b1", "b1", <-done)
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2012 by sdm. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package kson
+
+import (
+	"errors"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// IncludeKey is the key of include directive, its value is a file name or a list of file names.
+// Relative names are relative to the directory of the file which includes them.
+const IncludeKey = "include"
+
+type includer struct {
+	files []string // absolute names of files are being parsed
+}
+
+// ParseFileInclude parse a file like ParseFile, and resolve include directives of any hash.
+// Included files are merged in order as base of the hash, then the hash itself is merged on them, see Merge.
+func ParseFileInclude(filename string) (*Node, error) {
+	inc := &includer{}
+	return inc.parse(filename, nil, "")
+}
+
+// ParseFiles parse files by ParseFileInclude, and merge them in order, such as base.kson, prod.kson and host.kson
+func ParseFiles(filenames ...string) (node *Node, err error) {
+	for _, filename := range filenames {
+		x, err := ParseFileInclude(filename)
+		if err != nil {
+			return nil, err
+		}
+		node = Merge(node, x)
+	}
+	if node == nil {
+		node = newHash()
+	}
+	return node, nil
+}
+
+// parse parse file, from is the include directive, path is its path
+func (inc *includer) parse(filename string, from *Node, path string) (*Node, error) {
+	abs, err := filepath.Abs(filename)
+	if err != nil {
+		return nil, inc.error(from, path, err)
+	}
+	for i, f := range inc.files {
+		if f == abs {
+			cycle := append(append([]string(nil), inc.files[i:]...), abs)
+			return nil, inc.error(from, path, errors.New("include cycle "+strings.Join(cycle, " -> ")))
+		}
+	}
+
+	node, err := ParseFile(filename)
+	if err != nil {
+		return nil, inc.error(from, path, err)
+	}
+
+	inc.files = append(inc.files, abs)
+	node, err = inc.resolve(node, filepath.Dir(filename), "")
+	inc.files = inc.files[:len(inc.files)-1]
+	return node, err
+}
+
+func (inc *includer) error(from *Node, path string, err error) error {
+	if from == nil {
+		return err
+	}
+	return &ValueError{Pos: from.Pos, Path: path, Err: err}
+}
+
+// resolve include directives of n and its children
+func (inc *includer) resolve(n *Node, dir string, path string) (node *Node, err error) {
+	switch n.Type {
+	case NodeList:
+		for i, child := range n.List {
+			if n.List[i], err = inc.resolve(child, dir, path+"["+strconv.Itoa(i)+"]"); err != nil {
+				return
+			}
+		}
+	case NodeHash:
+		for _, name := range n.orderedKeys() {
+			if name == IncludeKey {
+				continue
+			}
+			if n.Hash[name], err = inc.resolve(n.Hash[name], dir, appendPathKey(path, name)); err != nil {
+				return
+			}
+		}
+
+		directive, ok := n.Hash[IncludeKey]
+		if !ok {
+			break
+		}
+		path = appendPathKey(path, IncludeKey)
+
+		var files []*Node
+		switch directive.Type {
+		case NodeLiteral:
+			files = []*Node{directive}
+		case NodeList:
+			files = directive.List
+		default:
+			return nil, inc.error(directive, path, errors.New("include should be a file name or a list of file names"))
+		}
+
+		var base *Node
+		for _, file := range files {
+			if file.Type != NodeLiteral || file.Literal == "" {
+				return nil, inc.error(file, path, errors.New("include should be a file name or a list of file names"))
+			}
+			filename := file.Literal
+			if !filepath.IsAbs(filename) {
+				filename = filepath.Join(dir, filename)
+			}
+			x, err := inc.parse(filename, file, path)
+			if err != nil {
+				return nil, err
+			}
+			base = Merge(base, x)
+		}
+
+		n.remove(IncludeKey)
+		return Merge(base, n), nil
+	}
+	return n, nil
+}
@@ -0,0 +1,232 @@
+// Copyright 2012 by sdm. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package kson
+
+import (
+	"bytes"
+	"errors"
+	"os"
+	"strconv"
+	"strings"
+)
+
+/*
+Interpolation
+
+	${Db_Log.Host}          value of another path, path is from root, such as Roles[0].Name
+	${HOME}                 environment variable if there is no such path
+	${ENV:DB_PASSWORD}      environment variable only
+	${ENV:DB_PASSWORD:-pwd} default value if the variable or path is missing or empty, default can contain ${...}
+	$${                     escape of ${
+
+A literal which is exactly ${path} of a list or hash is replaced by a copy of it.
+*/
+
+const (
+	interpolating = iota + 1
+	interpolated
+)
+
+type interpolator struct {
+	root  *Node
+	env   func(string) (string, bool)
+	state map[*Node]int
+	stack []string // paths are being resolved
+}
+
+// Interpolate resolve ${...} in all literals, env is used to lookup environment variables, it's os.LookupEnv if nil.
+// It should be called before Value if needed.
+func (n *Node) Interpolate(env func(name string) (string, bool)) error {
+	if env == nil {
+		env = os.LookupEnv
+	}
+	ip := &interpolator{root: n, env: env, state: make(map[*Node]int)}
+	return ip.walk(n, "")
+}
+
+func (ip *interpolator) walk(n *Node, path string) error {
+	switch n.Type {
+	case NodeLiteral:
+		return ip.resolve(n, path)
+	case NodeList:
+		for i, child := range n.List {
+			if err := ip.walk(child, path+"["+strconv.Itoa(i)+"]"); err != nil {
+				return err
+			}
+		}
+	case NodeHash:
+		for _, name := range n.orderedKeys() {
+			if err := ip.walk(n.Hash[name], appendPathKey(path, name)); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (ip *interpolator) errorf(n *Node, path string, msg string) error {
+	return &ValueError{Pos: n.Pos, Path: path, Err: errors.New(msg)}
+}
+
+// resolve interpolate literal n
+func (ip *interpolator) resolve(n *Node, path string) error {
+	switch ip.state[n] {
+	case interpolated:
+		return nil
+	case interpolating:
+		return ip.errorf(n, path, "reference cycle "+strings.Join(append(ip.stack, path), " -> "))
+	}
+	if n.Type != NodeLiteral || !strings.Contains(n.Literal, "${") {
+		ip.state[n] = interpolated
+		return nil
+	}
+
+	ip.state[n] = interpolating
+	ip.stack = append(ip.stack, path)
+	defer func() {
+		ip.stack = ip.stack[:len(ip.stack)-1]
+		ip.state[n] = interpolated
+	}()
+
+	// whole literal is a reference of list or hash
+	if expr, ok := wholeExpr(n.Literal); ok && !strings.HasPrefix(expr, "ENV:") && !strings.Contains(expr, ":-") {
+		if target, found := ip.lookup(expr); found && target.Type != NodeLiteral {
+			if err := ip.walk(target, expr); err != nil {
+				return err
+			}
+			pos := n.Pos
+			*n = *target.Clone()
+			n.Pos = pos
+			return nil
+		}
+	}
+
+	s, err := ip.expand(n, path, n.Literal)
+	if err != nil {
+		return err
+	}
+	n.Literal = s
+	return nil
+}
+
+// wholeExpr return expr if s is ${expr}
+func wholeExpr(s string) (string, bool) {
+	if !strings.HasPrefix(s, "${") || exprEnd(s, 2) != len(s)-1 {
+		return "", false
+	}
+	return s[2 : len(s)-1], true
+}
+
+// exprEnd return index of } which close ${ before start, or -1
+func exprEnd(s string, start int) int {
+	deep := 1
+	for i := start; i < len(s); i++ {
+		switch {
+		case s[i] == '$' && i+1 < len(s) && s[i+1] == '{':
+			deep++
+			i++
+		case s[i] == '}':
+			if deep--; deep == 0 {
+				return i
+			}
+		}
+	}
+	return -1
+}
+
+// expand replace all ${...} in s, n and path are used in errors
+func (ip *interpolator) expand(n *Node, path string, s string) (string, error) {
+	var buf bytes.Buffer
+	for {
+		i := strings.Index(s, "${")
+		if i < 0 {
+			buf.WriteString(s)
+			return buf.String(), nil
+		}
+		if i > 0 && s[i-1] == '$' {
+			buf.WriteString(s[:i-1])
+			buf.WriteString("${")
+			s = s[i+2:]
+			continue
+		}
+
+		end := exprEnd(s, i+2)
+		if end < 0 {
+			return "", ip.errorf(n, path, "${ is not closed")
+		}
+		buf.WriteString(s[:i])
+		value, err := ip.eval(n, path, s[i+2:end])
+		if err != nil {
+			return "", err
+		}
+		buf.WriteString(value)
+		s = s[end+1:]
+	}
+}
+
+// eval return value of expression between ${ and }
+func (ip *interpolator) eval(n *Node, path string, expr string) (string, error) {
+	name, def, hasDefault := expr, "", false
+	if i := strings.Index(expr, ":-"); i >= 0 {
+		name, def, hasDefault = expr[:i], expr[i+2:], true
+	}
+
+	var value string
+	var ok bool
+	if strings.HasPrefix(name, "ENV:") {
+		value, ok = ip.env(name[4:])
+	} else if target, found := ip.lookup(name); found {
+		if target.Type != NodeLiteral {
+			return "", ip.errorf(n, path, "can not interpolate "+nameOfNodeType(target.Type)+" "+name+" in text")
+		}
+		if err := ip.resolve(target, name); err != nil {
+			return "", err
+		}
+		value, ok = target.Literal, true
+	} else {
+		value, ok = ip.env(name)
+	}
+
+	if hasDefault && value == "" {
+		return ip.expand(n, path, def)
+	}
+	if !ok {
+		return "", ip.errorf(n, path, name+" is not defined")
+	}
+	return value, nil
+}
+
+// lookup return node of path from root
+func (ip *interpolator) lookup(path string) (node *Node, ok bool) {
+	sels, err := parsePath(path)
+	if err != nil || len(sels) == 0 {
+		return
+	}
+	node = ip.root
+	for _, sel := range sels {
+		if node, ok = node.elem(sel); !ok {
+			return
+		}
+	}
+	return node, true
+}
+
+// Clone return a deep copy of n
+func (n *Node) Clone() *Node {
+	x := *n
+	if n.List != nil {
+		x.List = make([]*Node, len(n.List))
+		for i, child := range n.List {
+			x.List[i] = child.Clone()
+		}
+	}
+	if n.Hash != nil {
+		x.Hash = make(map[string]*Node, len(n.Hash))
+		for name, child := range n.Hash {
+			x.Hash[name] = child.Clone()
+		}
+		x.Keys = append([]string(nil), n.Keys...)
+	}
+	return &x
+}
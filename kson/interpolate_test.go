@@ -0,0 +1,92 @@
+// Copyright 2012 by sdm. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package kson_test
+
+import (
+	"github.com/sdming/kiss/kson"
+	"github.com/sdming/kiss/ktest"
+	"strings"
+	"testing"
+)
+
+var interpolateData = `
+{
+	Home:		${HOME}/data
+	Password:	${ENV:DB_PASSWORD:-secret}
+	Empty:		${ENV:EMPTY:-${Db_Log.User}}
+	Url:		mysql://${Db_Log.User}@${Db_Log.Host}:${Db_Log.Port:-3306}
+	Escape:		$${HOME}
+	Db_Log:	{
+		Host:	${Hosts[0]}
+		User:	root
+	}
+	Hosts:	[
+		${ENV:HOST}
+	]
+	Copy:	${Db_Log}
+}
+`
+
+func testEnv(name string) (string, bool) {
+	switch name {
+	case "HOME":
+		return "/home/kson", true
+	case "HOST":
+		return "10.0.0.1", true
+	case "EMPTY":
+		return "", true
+	}
+	return "", false
+}
+
+func TestInterpolate(t *testing.T) {
+	node, err := kson.Parse([]byte(interpolateData))
+	if err != nil {
+		t.Error("parse error", err)
+		return
+	}
+	if err = node.Interpolate(testEnv); err != nil {
+		t.Error("interpolate error", err)
+		return
+	}
+
+	ktest.Equal(t, "env", "/home/kson/data", node.ChildString("Home"))
+	ktest.Equal(t, "default", "secret", node.ChildString("Password"))
+	ktest.Equal(t, "empty env uses default", "root", node.ChildString("Empty"))
+	ktest.Equal(t, "references", "mysql://root@10.0.0.1:3306", node.ChildString("Url"))
+	ktest.Equal(t, "escape", "${HOME}", node.ChildString("Escape"))
+
+	s, _ := node.QueryString("Copy.Host")
+	ktest.Equal(t, "copy of hash", "10.0.0.1", s)
+	ktest.Equal(t, "copy keeps key order", "[Host User]", fmtKeys(node.MustChild("Copy").Keys))
+
+	var c struct {
+		Url    string
+		Db_Log Db
+	}
+	node.Value(&c)
+	ktest.Equal(t, "Value after Interpolate", "10.0.0.1", c.Db_Log.Host)
+}
+
+func TestInterpolateError(t *testing.T) {
+	cases := map[string]string{
+		"{\n\ta:\t${b}\n\tb:\t${c}\n\tc:\t${a}\n}": "2:5: a: reference cycle a -> b -> c -> a",
+		"{\n\ta:\t${NOT_EXISTS}\n}":                "2:5: a: NOT_EXISTS is not defined",
+		"{\n\ta:\tx${b\n}":                         "2:5: a: ${ is not closed",
+		"{\n\ta:\tx${b}\n\tb:\t[\n\t\t1\n\t]\n}":   "2:5: a: can not interpolate list b in text",
+		"{\n\ta:\t{\n\t\tb:\t${a}\n\t}\n}":         "3:6: a.b: reference cycle a.b -> a.b",
+	}
+
+	for data, expect := range cases {
+		node, err := kson.Parse([]byte(data))
+		if err != nil {
+			t.Error("parse error", err, data)
+			continue
+		}
+		err = node.Interpolate(testEnv)
+		if err == nil || !strings.HasPrefix(err.Error(), expect) {
+			t.Errorf("interpolate %q: expect %s; actual %v", data, expect, err)
+		}
+	}
+}
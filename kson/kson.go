@@ -5,14 +5,10 @@ package kson
 
 import (
 	"bytes"
-	"errors"
-	"fmt"
+	"encoding"
 	"github.com/sdming/kiss/gotype"
-	"io"
 	"io/ioutil"
 	"reflect"
-	"regexp"
-	"runtime"
 	"sort"
 	"strconv"
 	"strings"
@@ -29,10 +25,9 @@ const (
 	NodeLiteral
 	NodeHash
 	NodeList
+	NodeNull // null, a nil pointer, map or slice
 )
 
-var commentsReg *regexp.Regexp = regexp.MustCompile(`^[\s]*#`)
-
 func nameOfNodeType(typ int) string {
 	switch typ {
 	case NodeLiteral:
@@ -41,19 +36,25 @@ func nameOfNodeType(typ int) string {
 		return "hash"
 	case NodeList:
 		return "list"
+	case NodeNull:
+		return "null"
 	case NodeNone:
 		return "none"
 	}
 
-	panic(&InvalidNodeTypeError{typ})
+	panic(&InvalidNodeTypeError{NodeType: typ})
 }
 
-// Node 
+// Node is a literal, list, hash or null of kson.
+// an unquoted null is a NodeNull, it was the literal "null" in older versions,
+// String of it returns an *InvalidNodeTypeError, quote it as "null" to get the string
 type Node struct {
 	Type    int
 	Literal string
 	List    []*Node
 	Hash    map[string]*Node
+	Keys    []string // keys of Hash in source order
+	Pos     Position // where the node start in source
 }
 
 // type LiteralNode []byte
@@ -64,18 +65,51 @@ type Node struct {
 
 type InvalidNodeTypeError struct {
 	NodeType int
+	Pos      Position
 }
 
 func (e *InvalidNodeTypeError) Error() string {
-	return "invalid node type: " + nameOfNodeType(e.NodeType)
+	s := "invalid node type: " + nameOfNodeType(e.NodeType)
+	if e.Pos.IsValid() {
+		s = e.Pos.String() + ": " + s
+	}
+	return s
 }
 
 type NodeNotExistsError struct {
 	Name string
+	Pos  Position // position of parent node
 }
 
 func (e *NodeNotExistsError) Error() string {
-	return e.Name + " is not exists"
+	s := e.Name + " is not exists"
+	if e.Pos.IsValid() {
+		s = e.Pos.String() + ": " + s
+	}
+	return s
+}
+
+// ValueError describes an error of a node, such as unmarshal it to go value or interpolate it
+type ValueError struct {
+	Pos  Position
+	Path string // path of node, such as Roles[0].Allow
+	Err  error
+}
+
+func (e *ValueError) Error() string {
+	s := e.Err.Error()
+	if e.Path != "" {
+		s = e.Path + ": " + s
+	}
+	if e.Pos.IsValid() {
+		s = e.Pos.String() + ": " + s
+	}
+	return s
+}
+
+// IsNull return true if n is null, a missing child is not null and an empty literal is ""
+func (n *Node) IsNull() bool {
+	return n.Type == NodeNull
 }
 
 // Child return child node by name, ok is false if name doesn't exist
@@ -98,27 +132,28 @@ func (n *Node) Child(name string) (child *Node, ok bool) {
 	return
 }
 
-// Query return child node by path, just like query
-func (n *Node) Query(path string) (child *Node, ok bool) {
-	names := strings.Split(path, " ")
-	if names == nil || len(names) == 0 {
-		return child, false
-	}
+// newHash return an empty hash node
+func newHash() *Node {
+	return &Node{Type: NodeHash, Hash: make(map[string]*Node, capacity)}
+}
 
-	current := n
-	for _, name := range names {
-		name = strings.TrimSpace(name)
-		if name == "" {
-			continue
-		}
+// put set child of hash by name, name is appended to Keys if it's new
+func (n *Node) put(name string, child *Node) {
+	if _, ok := n.Hash[name]; !ok {
+		n.Keys = append(n.Keys, name)
+	}
+	n.Hash[name] = child
+}
 
-		if child, ok = current.Child(name); !ok {
-			return
-		} else {
-			current = child
+// remove delete child of hash by name
+func (n *Node) remove(name string) {
+	delete(n.Hash, name)
+	for i, key := range n.Keys {
+		if key == name {
+			n.Keys = append(n.Keys[:i], n.Keys[i+1:]...)
+			break
 		}
 	}
-	return
 }
 
 // Child return child node by name, ok is false if name doesn't exist
@@ -148,7 +183,7 @@ func (n *Node) ChildInt(name string) int64 {
 			panic(err)
 		}
 	}
-	panic(&NodeNotExistsError{name})
+	panic(&NodeNotExistsError{Name: name, Pos: n.Pos})
 }
 
 // ChildUint return child value as uint64
@@ -160,7 +195,7 @@ func (n *Node) ChildUint(name string) uint64 {
 			panic(err)
 		}
 	}
-	panic(&NodeNotExistsError{name})
+	panic(&NodeNotExistsError{Name: name, Pos: n.Pos})
 }
 
 // ChildFloat return child value as float64
@@ -172,7 +207,7 @@ func (n *Node) ChildFloat(name string) float64 {
 			panic(err)
 		}
 	}
-	panic(&NodeNotExistsError{name})
+	panic(&NodeNotExistsError{Name: name, Pos: n.Pos})
 }
 
 // ChildBool return child value as bool
@@ -184,7 +219,7 @@ func (n *Node) ChildBool(name string) bool {
 			panic(err)
 		}
 	}
-	panic(&NodeNotExistsError{name})
+	panic(&NodeNotExistsError{Name: name, Pos: n.Pos})
 }
 
 // ChildString return child value as string
@@ -196,7 +231,7 @@ func (n *Node) ChildString(name string) string {
 			panic(err)
 		}
 	}
-	panic(&NodeNotExistsError{name})
+	panic(&NodeNotExistsError{Name: name, Pos: n.Pos})
 }
 
 // ChildIntOrDefault return child value as int64, return defaultValue if child doesn't exist
@@ -252,7 +287,7 @@ func (n *Node) ChildStringOrDefault(name string, defaultValue string) string {
 // Int returns n's underlying value, as an int64.
 func (n *Node) Int() (i int64, err error) {
 	if n.Type != NodeLiteral {
-		err = &InvalidNodeTypeError{n.Type}
+		err = &InvalidNodeTypeError{NodeType: n.Type, Pos: n.Pos}
 		return
 	}
 	return strconv.ParseInt(n.Literal, 0, 64)
@@ -261,7 +296,7 @@ func (n *Node) Int() (i int64, err error) {
 // Uint returns n's underlying value, as an uint64.
 func (n *Node) Uint() (i uint64, err error) {
 	if n.Type != NodeLiteral {
-		err = &InvalidNodeTypeError{n.Type}
+		err = &InvalidNodeTypeError{NodeType: n.Type, Pos: n.Pos}
 		return
 	}
 	return strconv.ParseUint(n.Literal, 0, 64)
@@ -270,7 +305,7 @@ func (n *Node) Uint() (i uint64, err error) {
 // Float returns n's underlying value, as an float64.
 func (n *Node) Float() (f float64, err error) {
 	if n.Type != NodeLiteral {
-		err = &InvalidNodeTypeError{n.Type}
+		err = &InvalidNodeTypeError{NodeType: n.Type, Pos: n.Pos}
 		return
 	}
 	return strconv.ParseFloat(n.Literal, 64)
@@ -279,7 +314,7 @@ func (n *Node) Float() (f float64, err error) {
 // Bool returns n's underlying value, as an bool.
 func (n *Node) Bool() (b bool, err error) {
 	if n.Type != NodeLiteral {
-		err = &InvalidNodeTypeError{n.Type}
+		err = &InvalidNodeTypeError{NodeType: n.Type, Pos: n.Pos}
 		return
 	}
 	return strconv.ParseBool(n.Literal)
@@ -288,7 +323,7 @@ func (n *Node) Bool() (b bool, err error) {
 // String returns n's underlying value, as an string.
 func (n *Node) String() (s string, err error) {
 	if n.Type != NodeLiteral {
-		err = &InvalidNodeTypeError{n.Type}
+		err = &InvalidNodeTypeError{NodeType: n.Type, Pos: n.Pos}
 		return
 	}
 	return n.Literal, nil
@@ -297,7 +332,7 @@ func (n *Node) String() (s string, err error) {
 // Slice returns []string.
 func (n *Node) Slice() (data []string, err error) {
 	if n.Type != NodeList {
-		err = &InvalidNodeTypeError{n.Type}
+		err = &InvalidNodeTypeError{NodeType: n.Type, Pos: n.Pos}
 		return
 	}
 
@@ -317,7 +352,7 @@ func (n *Node) Slice() (data []string, err error) {
 // Map returns map[string]string
 func (n *Node) Map() (data map[string]string, err error) {
 	if n.Type != NodeHash {
-		err = &InvalidNodeTypeError{n.Type}
+		err = &InvalidNodeTypeError{NodeType: n.Type, Pos: n.Pos}
 		return
 	}
 
@@ -334,31 +369,44 @@ func (n *Node) Map() (data map[string]string, err error) {
 	return
 }
 
+// MarshalKSON return n itself, so a *Node can be used as field to keep raw node
+func (n *Node) MarshalKSON() (*Node, error) {
+	return n, nil
+}
+
+// UnmarshalKSON set n to a copy of node
+func (n *Node) UnmarshalKSON(node *Node) error {
+	*n = *node
+	return nil
+}
+
 // Value unmarshal data to the value pointed to by a.
+// a is decoded onto, so it can hold defaults: fields and map keys which are not in n keep their values,
+// nested structs, maps and pointers are merged, slices are replaced unless DecoderOptions.AppendSlices
+// or tag option append is set. maps and pointees of a are modified in place, they are shared by copies of a.
 func (n *Node) Value(a interface{}) (err error) {
+	return newDecodeState(n).value(n, a)
+}
 
-	defer func() {
-		if r := recover(); r != nil {
-			if _, ok := r.(runtime.Error); ok {
-				panic(r)
-			}
-			if e, ok := r.(error); ok {
-				err = e
-			} else {
-				err = errors.New(fmt.Sprint(r))
-			}
-		}
-	}()
+// ValueStrict is like Value, but it reports unknown keys, literals can not be converted,
+// mismatched node types and overflow as a MultiError, each error has path and position of node.
+func (n *Node) ValueStrict(a interface{}) (err error) {
+	return n.ValueOptions(a, DecoderOptions{Strict: true})
+}
 
-	v := reflect.ValueOf(a)
-	n.set(v)
-	return
+// ValueOptions is like Value, but decodes in the way of opts
+func (n *Node) ValueOptions(a interface{}, opts DecoderOptions) (err error) {
+	d := newDecodeState(n)
+	d.strict, d.infer, d.timeLayouts = opts.Strict, opts.Infer, opts.TimeLayouts
+	d.appendSlices = opts.AppendSlices
+	return d.value(n, a)
 }
 
-func (n *Node) setArray(v reflect.Value) {
+func (n *Node) setArray(d *decodeState, v reflect.Value, p *typePlan) {
 
 	kind := v.Kind()
 	if n.Type != NodeList || (kind != reflect.Slice && kind != reflect.Array) {
+		d.mismatch(n, v)
 		return
 	}
 
@@ -370,27 +418,43 @@ func (n *Node) setArray(v reflect.Value) {
 		return
 	}
 
-	l := len(n.List)
+	l, base := len(n.List), 0
 	if kind == reflect.Slice {
-		if v.CanSet() {
-			v.Set(reflect.MakeSlice(v.Type(), l, l))
-		} else {
+		if !v.CanSet() {
 			return
 		}
+		if d.appendSlices {
+			base = v.Len()
+		}
+		// a new slice, so items are not written to an array shared with defaults,
+		// [] is an empty slice, not nil
+		if base > 0 || l == 0 {
+			slice := reflect.MakeSlice(v.Type(), base+l, base+l)
+			reflect.Copy(slice, v.Slice(0, base))
+			v.Set(slice)
+		} else {
+			v.SetZero()
+			v.Grow(l)
+			v.SetLen(l)
+		}
 	}
 
 	vl := v.Len()
-	elemType := typ.Elem()
-	elemKind := elemType.Kind()
-	simple := gotype.IsSimple(elemKind)
+	ep := p.elemPlan()
+
+	if l > vl {
+		d.report("list has %d items, length of %s is %d", l, typ, vl)
+	}
 
 	for i, x := range n.List {
-		if i < vl { // capacity of array maybe less of i
-			if simple && x.Type == NodeLiteral {
-				gotype.Value(v.Index(i)).Parse(x.Literal)
+		if base+i < vl { // capacity of array maybe less of i
+			d.enterIndex(i, x)
+			if ep.plain && x.Type == NodeLiteral {
+				d.parseLiteral(x, v.Index(base+i))
 			} else {
-				x.set(v.Index(i))
+				x.setPlan(d, v.Index(base+i), ep)
 			}
+			d.exit()
 		}
 	}
 
@@ -402,13 +466,14 @@ func (n *Node) setArray(v reflect.Value) {
 	}
 }
 
-func (n *Node) setMap(v reflect.Value) {
+func (n *Node) setMap(d *decodeState, v reflect.Value, p *typePlan) {
 
 	// fmt.Println("setmap", nameOfNodeType(n.Type), v.Type(), v.Kind())
 	// fmt.Println(n.Dump())
 
 	kind := v.Kind()
 	if n.Type != NodeHash || kind != reflect.Map {
+		d.mismatch(n, v)
 		return
 	}
 
@@ -420,49 +485,91 @@ func (n *Node) setMap(v reflect.Value) {
 		return
 	}
 
-	if typ.Key() != gotype.TypeString { // only support string key
+	keyType := typ.Key()
+	if !p.mapKey {
+		d.report("unsupported key type of %s", typ)
 		return
 	}
 
+	merge := !v.IsNil() && v.Len() > 0 // values are merged into those of a map with items only
 	if v.IsNil() {
 		if v.CanSet() {
-			v.Set(reflect.MakeMap(typ))
+			v.Set(reflect.MakeMapWithSize(typ, len(n.Hash)))
 		} else {
 			return
 		}
 	}
 
-	elemType := typ.Elem()
-	elemKind := elemType.Kind()
-	simple := gotype.IsSimple(elemKind)
-
+	// key and mapElem are reused, SetMapIndex copies them
+	ep := p.elemPlan()
+	var key reflect.Value
+	if keyType == gotype.TypeString {
+		key = reflect.New(keyType).Elem()
+	}
+	mapElem := reflect.New(ep.typ).Elem()
 	for name, x := range n.Hash {
-		if simple && x.Type == NodeLiteral {
-			mapElem, err := gotype.Atok(x.Literal, elemKind)
-			if err == nil {
-				v.SetMapIndex(reflect.ValueOf(name), mapElem)
-			}
+		d.enterKey(name, x)
+		if keyType == gotype.TypeString {
+			key.SetString(name)
+		} else if k, err := parseMapKey(name, keyType); err != nil {
+			d.report("key %s for %s: %v", strconv.Quote(name), keyType, err)
+			d.exit()
+			continue
 		} else {
-			var mapElem reflect.Value
-			if elemType.Kind() == reflect.Ptr {
-				mapElem = reflect.New(elemType.Elem())
-			} else {
-				mapElem = reflect.New(elemType)
+			key = k
+		}
+
+		mapElem.SetZero()
+		if merge {
+			if old := v.MapIndex(key); old.IsValid() {
+				mapElem.Set(old) // merge into existing value
 			}
-			x.set(mapElem)
-			v.SetMapIndex(reflect.ValueOf(name), mapElem)
 		}
+		if ep.plain && x.Type == NodeLiteral {
+			if d.parseLiteral(x, mapElem) {
+				v.SetMapIndex(key, mapElem)
+			}
+		} else {
+			x.setPlan(d, mapElem, ep)
+			v.SetMapIndex(key, mapElem)
+		}
+		d.exit()
 	}
 }
 
-func (n *Node) setObject(v reflect.Value) {
+// isMapKey return true if a key of type t can be parsed from name of hash item
+func isMapKey(t reflect.Type) bool {
+	return gotype.IsSimple(t.Kind()) || reflect.PtrTo(t).Implements(textUnmarshalerType)
+}
+
+// parseMapKey parse name of hash item to a key of type t, such as int, bool, named string or TextUnmarshaler
+func parseMapKey(name string, t reflect.Type) (reflect.Value, error) {
+	key := reflect.New(t)
+	if tu, ok := key.Interface().(encoding.TextUnmarshaler); ok {
+		err := tu.UnmarshalText([]byte(name))
+		return key.Elem(), err
+	}
+	if t.Kind() == reflect.String {
+		return reflect.ValueOf(name).Convert(t), nil
+	}
+	if err := gotype.Value(key.Elem()).TryParse(name); err != nil {
+		if e, ok := err.(*strconv.NumError); ok {
+			err = e.Err
+		}
+		return key.Elem(), err
+	}
+	return key.Elem(), nil
+}
+
+func (n *Node) setObject(d *decodeState, v reflect.Value, p *typePlan) {
 
 	kind := v.Kind()
 	if n.Type != NodeHash || kind != reflect.Struct {
+		d.mismatch(n, v)
 		return
 	}
 
-	typ := v.Type()
+	typ := p.typ
 	if n.Hash == nil {
 		if v.CanSet() {
 			v.Set(reflect.Zero(typ))
@@ -470,80 +577,195 @@ func (n *Node) setObject(v reflect.Value) {
 		}
 	}
 
-	numFiled := typ.NumField()
-	for i := 0; i < numFiled; i++ {
-		field := typ.Field(i)
-		if field.PkgPath != "" {
-			continue
-		}
+	var matched map[*Node]bool
+	if d.strict {
+		matched = make(map[*Node]bool, len(n.Hash))
+	}
 
-		name := field.Name
-		filedNode, ok := n.Child(name)
-		if !ok {
-			filedNode, ok = n.ChildFold(name)
+	// keys are matched to names of fields, then case-insensitively if some keys are left
+	exact := 0
+	for i, name := range p.names {
+		if x, ok := n.Hash[name]; ok {
+			exact++
+			if matched != nil {
+				matched[x] = true
+			}
+			x.setField(d, v, p, i)
 		}
-		if !ok {
-			continue
+	}
+	if exact < len(n.Hash) {
+		for i, name := range p.names {
+			if _, ok := n.Hash[name]; ok {
+				continue
+			}
+			if x, ok := n.ChildFold(name); ok {
+				if matched != nil {
+					matched[x] = true
+				}
+				x.setField(d, v, p, i)
+			}
 		}
+	}
 
-		fv := v.Field(i)
-		if !fv.CanSet() {
-			continue
+	if matched != nil && len(matched) < len(n.Hash) {
+		for name, x := range n.Hash {
+			if !matched[x] {
+				d.enterKey(name, x)
+				d.report("unknown key %s of %s", name, typ)
+				d.exit()
+			}
 		}
+	}
+}
 
-		kind := field.Type.Kind()
-		if filedNode.Type == NodeLiteral && gotype.IsSimple(kind) {
-			gotype.Value(fv).Parse(filedNode.Literal)
-		} else {
-			filedNode.set(fv)
-		}
+// setField decode n into the ith field of struct v, p is plan of v
+func (n *Node) setField(d *decodeState, v reflect.Value, p *typePlan, i int) {
+	field := &p.fields[i]
+	fv, ok := fieldByIndex(v, field.index, true)
+	if !ok || !fv.CanSet() {
+		return
 	}
 
+	d.enterKey(field.name, n)
+	appendSlices := d.appendSlices
+	if field.appendSlices || field.replaceSlices {
+		d.appendSlices = field.appendSlices
+	}
+	fp := p.fieldPlan(i)
+	if n.Type == NodeLiteral && fp.plain {
+		d.parseLiteral(n, fv)
+	} else {
+		n.setPlan(d, fv, fp)
+	}
+	d.appendSlices = appendSlices
+	d.exit()
 }
 
-func (n *Node) set(v reflect.Value) {
+// set decode n into v
+func (n *Node) set(d *decodeState, v reflect.Value) {
+	if v.IsValid() {
+		n.setPlan(d, v, planOf(v.Type()))
+	}
+}
 
-	// if !v.CanSet() || !v.IsValid() {
-	// 	return
-	// }
+// setPlan decode n into v, p is plan of type of v
+func (n *Node) setPlan(d *decodeState, v reflect.Value, p *typePlan) {
+	if n.Type == NodeNull {
+		n.setNull(d, v, p)
+		return
+	}
 
-	// fmt.Println("set==", nameOfNodeType(n.Type), v.Type(), v.Kind())
-	// fmt.Println(n.Dump())
+	if p.typ == gotype.TypeTime {
+		if n.Type != NodeLiteral {
+			d.mismatch(n, v)
+		} else if n.Literal != "" {
+			d.parseLiteral(n, v)
+		}
+		return
+	}
 
-	kind := v.Kind()
+	if p.unmarshaler {
+		if u, tu := unmarshaler(v); u != nil {
+			if err := u.UnmarshalKSON(n); err != nil {
+				d.fail(err)
+			}
+			return
+		} else if tu != nil {
+			if n.Type == NodeLiteral {
+				if err := tu.UnmarshalText([]byte(n.Literal)); err != nil {
+					d.fail(err)
+				}
+			} else {
+				d.mismatch(n, v)
+			}
+			return
+		}
+	}
+
+	kind := p.kind
 	switch {
 	case gotype.IsSimple(kind):
-		if n.Literal != "" {
-			gotype.Value(v).Parse(n.Literal)
+		if n.Type != NodeLiteral {
+			d.mismatch(n, v)
+		} else if n.Literal != "" {
+			d.parseLiteral(n, v)
 		}
-	case kind == reflect.Invalid || kind == reflect.Uintptr || kind == reflect.UnsafePointer || kind == reflect.Func || kind == reflect.Chan || kind == reflect.Complex64 || kind == reflect.Complex128:
+	case kind == reflect.Uintptr || kind == reflect.UnsafePointer || kind == reflect.Func || kind == reflect.Chan || kind == reflect.Complex64 || kind == reflect.Complex128:
 		//TODO: unsupport
+		d.report("unsupported type %s", p.typ)
 	case kind == reflect.Array:
-		n.setArray(v)
+		n.setArray(d, v, p)
 	case kind == reflect.Slice:
-		n.setArray(v)
+		n.setArray(d, v, p)
 	case kind == reflect.Map:
-		n.setMap(v)
+		n.setMap(d, v, p)
 	case kind == reflect.Struct:
-		n.setObject(v)
+		n.setObject(d, v, p)
 	case kind == reflect.Interface:
-		if n.Type == NodeLiteral {
-			gotype.Value(v).Parse(n.Literal)
-		}
+		n.setInterface(d, v)
 	case kind == reflect.Ptr:
 		if v.IsNil() && v.CanSet() {
-			v.Set(reflect.New(v.Type().Elem()))
+			v.Set(reflect.New(p.typ.Elem()))
+		}
+		if !v.IsNil() {
+			n.setPlan(d, v.Elem(), p.elemPlan())
 		}
-		n.set(v.Elem())
 	default:
 		//TODO:
 	}
 }
 
+// setNull set pointer, map, slice or interface v to nil, other values are not changed unless they are Unmarshaler
+func (n *Node) setNull(d *decodeState, v reflect.Value, p *typePlan) {
+	switch p.kind {
+	case reflect.Ptr, reflect.Map, reflect.Slice, reflect.Interface:
+		if v.CanSet() {
+			v.Set(reflect.Zero(p.typ))
+		}
+		return
+	}
+	if !p.unmarshaler {
+		return
+	}
+	if u, _ := unmarshaler(v); u != nil {
+		if err := u.UnmarshalKSON(n); err != nil {
+			d.fail(err)
+		}
+	}
+}
+
+// setInterface set v to value of n, a non-nil pointer in v is decoded into, a map in v is merged with a hash,
+// otherwise an empty interface is set to string, []interface{} or map[string]interface{}, see Interface.
+func (n *Node) setInterface(d *decodeState, v reflect.Value) {
+	if !v.IsNil() && v.Elem().Kind() == reflect.Ptr && !v.Elem().IsNil() {
+		n.set(d, v.Elem())
+		return
+	}
+	if !v.IsNil() && v.Elem().Kind() == reflect.Map && !v.Elem().IsNil() && n.Type == NodeHash {
+		n.setMap(d, v.Elem(), planOf(v.Elem().Type()))
+		return
+	}
+	if v.NumMethod() > 0 {
+		d.report("can not unmarshal %s into %s", nameOfNodeType(n.Type), v.Type())
+		return
+	}
+	if !v.CanSet() {
+		return
+	}
+
+	if x := n.Interface(d.infer); x != nil {
+		v.Set(reflect.ValueOf(x))
+	} else {
+		v.Set(reflect.Zero(v.Type()))
+	}
+}
+
 func (n *Node) dumpto(w *indentWriter) {
 	switch n.Type {
 	case NodeNone:
 		return
+	case NodeNull:
+		w.WriteString("null")
 	case NodeLiteral:
 		//w.WriteIndent()
 		w.WriteString(n.Literal)
@@ -564,13 +786,7 @@ func (n *Node) dumpto(w *indentWriter) {
 		w.WriteString("\n")
 		w.Inner()
 
-		names := make([]string, 0, len(n.Hash))
-		for name, _ := range n.Hash {
-			names = append(names, name)
-		}
-		sort.Strings(names)
-
-		for _, name := range names {
+		for _, name := range n.orderedKeys() {
 			child := n.Hash[name]
 			w.WriteIndent()
 			w.WriteString(name)
@@ -584,6 +800,32 @@ func (n *Node) dumpto(w *indentWriter) {
 	}
 }
 
+// orderedKeys return keys of hash in source order, keys are not in n.Keys are sorted and put at last
+func (n *Node) orderedKeys() []string {
+	names := make([]string, 0, len(n.Hash))
+	for _, name := range n.Keys {
+		if _, ok := n.Hash[name]; ok {
+			names = append(names, name)
+		}
+	}
+	if len(names) == len(n.Hash) {
+		return names
+	}
+
+	seen := make(map[string]bool, len(names))
+	for _, name := range names {
+		seen[name] = true
+	}
+	more := make([]string, 0, len(n.Hash)-len(names))
+	for name, _ := range n.Hash {
+		if !seen[name] {
+			more = append(more, name)
+		}
+	}
+	sort.Strings(more)
+	return append(names, more...)
+}
+
 // Dump return dump of node as string
 func (n *Node) Dump() string {
 	w := &indentWriter{Indent: "\t"}
@@ -613,43 +855,17 @@ func (w *indentWriter) WriteIndent() {
 	}
 }
 
-// ParseFile parse a file, remove any line start with #(comments), add {\} auto at begin and end
+// ParseFile parse a file, skip any line start with #(comments), content of file is treated as a hash without { and }
 func ParseFile(filename string) (node *Node, err error) {
 
-	var f []byte
-	if f, err = ioutil.ReadFile(filename); err != nil {
+	var data []byte
+	if data, err = ioutil.ReadFile(filename); err != nil {
 		return
 	}
 
-	buff := bytes.NewBuffer(f)
-	var data bytes.Buffer
-	data.WriteString("{\n")
-
-	for {
-		var line []byte
-		end := false
-
-		if line, err = buff.ReadBytes('\n'); err != nil {
-			if err != io.EOF {
-				return
-			} else {
-				end = true
-			}
-		}
-
-		if commentsReg.Match(line) {
-			continue
-		}
-		if _, err = data.Write(line); err != nil {
-			return
-		}
-
-		if end {
-			break
-		}
-	}
-
-	data.WriteString("\n}\n")
-	node, err = Parse(data.Bytes())
-	return
+	dec := newDecoder(data)
+	dec.filename = filename
+	dec.comments = true
+	dec.implicit = true
+	return dec.parse()
 }
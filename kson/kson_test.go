@@ -4,7 +4,9 @@
 package kson_test
 
 import (
+	"bytes"
 	"encoding/json"
+	"fmt"
 	"github.com/sdming/kiss/kson"
 	"testing"
 )
@@ -207,3 +209,100 @@ func BenchmarkJsonUnmarshal(b *testing.B) {
 		}
 	}
 }
+
+func BenchmarkParse(b *testing.B) {
+	data := []byte(defaultConfigString)
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		if _, err := kson.Parse(data); err != nil {
+			b.Error("config parse error", err)
+		}
+	}
+}
+
+func BenchmarkJsonParse(b *testing.B) {
+	data := []byte(defaultJsonConfingString)
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		var v interface{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			b.Error("config parse error", err)
+		}
+	}
+}
+
+// largeConfigString is defaultConfigString with 200 roles
+var largeConfigString = func() string {
+	var buf bytes.Buffer
+	buf.WriteString("{\n\tLog_Level:\tdebug\n\tListen:\t\t8000\n\tRoles:\t[\n")
+	for i := 0; i < 200; i++ {
+		fmt.Fprintf(&buf, "\t\t{\n\t\t\tName:\trole%d\n\t\t\tAllow:\t[\n\t\t\t\t/user\n\t\t\t\t/order/%d\n\t\t\t]\n\t\t}\n", i, i)
+	}
+	buf.WriteString("\t]\n}\n")
+	return buf.String()
+}()
+
+func BenchmarkParseLarge(b *testing.B) {
+	data := []byte(largeConfigString)
+	b.SetBytes(int64(len(data)))
+	for i := 0; i < b.N; i++ {
+		if _, err := kson.Parse(data); err != nil {
+			b.Error("config parse error", err)
+		}
+	}
+}
+
+func BenchmarkJsonParseLarge(b *testing.B) {
+	node, err := kson.Parse([]byte(largeConfigString))
+	if err != nil {
+		b.Fatal(err)
+	}
+	data := node.JSON(false)
+	b.SetBytes(int64(len(data)))
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var v interface{}
+		if err := json.Unmarshal(data, &v); err != nil {
+			b.Error("config parse error", err)
+		}
+	}
+}
+
+func BenchmarkValue(b *testing.B) {
+	node, err := kson.Parse([]byte(defaultConfigString))
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var c Config
+		if err := node.Value(&c); err != nil {
+			b.Error("config value error", err)
+		}
+	}
+}
+
+func BenchmarkUnmarshalParallel(b *testing.B) {
+	data := []byte(defaultConfigString)
+	b.RunParallel(func(pb *testing.PB) {
+		for pb.Next() {
+			var c Config
+			if err := kson.Unmarshal(data, &c); err != nil {
+				b.Error("config unmarshal error", err)
+			}
+		}
+	})
+}
+
+func BenchmarkMarshalLarge(b *testing.B) {
+	var c Config
+	if err := kson.Unmarshal([]byte(largeConfigString), &c); err != nil {
+		b.Fatal(err)
+	}
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := kson.Marshal(c); err != nil {
+			b.Error(err)
+		}
+	}
+}
@@ -0,0 +1,102 @@
+// Copyright 2012 by sdm. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package kson
+
+import (
+	"fmt"
+)
+
+// maxDepth is the nesting limit when Limits.MaxDepth is 0, it's the same as encoding/json,
+// so walking nodes recursively, such as Value, Marshal and JSON, never overflows the stack
+const maxDepth = 10000
+
+// Limits bounds data a parse accepts, set them when data comes from users.
+// 0 means no limit, except MaxDepth whose default is 10000. exceeding a limit returns a *LimitError.
+type Limits struct {
+	MaxDepth   int // nesting of lists and hashes, the top level hash is 1
+	MaxBytes   int // length of data, or of each value read by Decoder
+	MaxNodes   int // count of nodes, it bounds items of lists and keys of hashes too
+	MaxLiteral int // length of a literal or key in bytes
+}
+
+// LimitError means data exceeds one of Limits
+type LimitError struct {
+	Limit string // name of field of Limits
+	Max   int
+	Pos   Position
+}
+
+func (e *LimitError) Error() string {
+	msg := fmt.Sprintf("%s %d is exceeded", e.Limit, e.Max)
+	if e.Pos.IsValid() {
+		return e.Pos.String() + ": " + msg
+	}
+	return msg
+}
+
+// ParseLimits is like Parse, but returns a *LimitError if data exceeds limits
+func ParseLimits(data []byte, limits Limits) (*Node, error) {
+	if len(data) == 0 {
+		return nil, &FormatError{Message: "data to parse is emty"}
+	}
+	dec := newDecoder(data)
+	dec.limits = limits
+	return dec.parse()
+}
+
+func (d *decoder) limitError(limit string, max int, off int) *LimitError {
+	return &LimitError{Limit: limit, Max: max, Pos: d.pos(off)}
+}
+
+// checkBytes return error if the whole data is longer than MaxBytes, it's checked before data is copied
+func (d *decoder) checkBytes() error {
+	if max := d.limits.MaxBytes; max > 0 && !d.one && d.length > max {
+		return d.limitError("MaxBytes", max, max)
+	}
+	return nil
+}
+
+// checkDepth return error if a list or hash starts at off would be nested too deep
+func (d *decoder) checkDepth(off int) error {
+	max := d.limits.MaxDepth
+	if max <= 0 {
+		max = maxDepth
+	}
+	if d.nesting >= max {
+		return d.limitError("MaxDepth", max, off)
+	}
+	return nil
+}
+
+// checkLiteral return error if literal or key s starts at off is longer than MaxLiteral
+func (d *decoder) checkLiteral(s string, off int) error {
+	if max := d.limits.MaxLiteral; max > 0 && len(s) > max {
+		return d.limitError("MaxLiteral", max, off)
+	}
+	return nil
+}
+
+// checkRead return error if nodes or bytes read so far exceed limits, off is where the last token starts
+func (d *decoder) checkRead(off int) error {
+	if max := d.limits.MaxNodes; max > 0 && d.slab.count > max {
+		return d.limitError("MaxNodes", max, off)
+	}
+	if max := d.limits.MaxBytes; max > 0 && d.off > max {
+		return d.limitError("MaxBytes", max, max)
+	}
+	return nil
+}
+
+// checkBuffered return error if the unfinished value in buffer is longer than MaxBytes,
+// so a value without end can't make the buffer grow forever. all data from scanp is that value.
+func (dec *Decoder) checkBuffered() error {
+	max := dec.opts.MaxBytes
+	if max <= 0 || len(dec.buf)-dec.scanp <= max {
+		return nil
+	}
+	d := newDecoder(dec.buf[dec.scanp:])
+	d.offBase = dec.offset
+	d.lineBase = dec.line
+	return d.limitError("MaxBytes", max, max)
+}
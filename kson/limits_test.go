@@ -0,0 +1,114 @@
+// Copyright 2012 by sdm. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package kson_test
+
+import (
+	"github.com/sdming/kiss/kson"
+	"github.com/sdming/kiss/ktest"
+	"io"
+	"strings"
+	"testing"
+)
+
+// nested return n lists nested in each other
+func nested(n int) string {
+	return strings.Repeat("[\n", n) + "x\n" + strings.Repeat("]\n", n)
+}
+
+func testLimit(t *testing.T, name string, data string, limits kson.Limits, limit string, line int) {
+	_, err := kson.ParseLimits([]byte(data), limits)
+	e, ok := err.(*kson.LimitError)
+	if !ok {
+		t.Errorf("%s: should return LimitError, actual %v", name, err)
+		return
+	}
+	ktest.Equal(t, name+" limit", limit, e.Limit)
+	ktest.Equal(t, name+" line", line, e.Pos.Line)
+}
+
+func TestLimits(t *testing.T) {
+	data := `{
+	Name:	app
+	Hosts:	[
+		a.io
+		b.io
+	]
+}`
+	limits := kson.Limits{MaxDepth: 2, MaxBytes: len(data), MaxNodes: 5, MaxLiteral: 5}
+	if _, err := kson.ParseLimits([]byte(data), limits); err != nil {
+		t.Error("parse in limits error", err)
+	}
+
+	testLimit(t, "depth", data, kson.Limits{MaxDepth: 1}, "MaxDepth", 3)
+	testLimit(t, "bytes", data, kson.Limits{MaxBytes: 20}, "MaxBytes", 3)
+	testLimit(t, "nodes", data, kson.Limits{MaxNodes: 4}, "MaxNodes", 5)
+	testLimit(t, "literal", data, kson.Limits{MaxLiteral: 4}, "MaxLiteral", 3)
+	testLimit(t, "key", "{\n\tLongName:\tx\n}", kson.Limits{MaxLiteral: 4}, "MaxLiteral", 2)
+
+	if _, err := kson.Parse([]byte(nested(100))); err != nil {
+		t.Error("parse 100 levels error", err)
+	}
+	testLimit(t, "default depth", nested(10001), kson.Limits{}, "MaxDepth", 10001)
+
+	var v interface{}
+	err := kson.UnmarshalOptions([]byte(nested(20)), &v, kson.DecoderOptions{Limits: kson.Limits{MaxDepth: 16}})
+	if _, ok := err.(*kson.LimitError); !ok {
+		t.Errorf("unmarshal should return LimitError, actual %v", err)
+	}
+	ktest.Equal(t, "error", "17:1: MaxDepth 16 is exceeded", err.Error())
+}
+
+func TestDecoderLimits(t *testing.T) {
+	small := "{\n\ta:\t1\n}\n"
+	dec := kson.NewDecoder(strings.NewReader(strings.Repeat(small, 100)))
+	dec.Limit(kson.Limits{MaxBytes: len(small)})
+	count := 0
+	for {
+		_, err := dec.DecodeNode()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			t.Error("decode small values error", err)
+			return
+		}
+		count++
+	}
+	ktest.Equal(t, "count", 100, count)
+
+	// a value which never ends
+	dec = kson.NewDecoder(strings.NewReader(small + "[\n" + strings.Repeat("\titem\n", 10000)))
+	dec.Limit(kson.Limits{MaxBytes: 1024})
+	if _, err := dec.DecodeNode(); err != nil {
+		t.Error("decode 1 error", err)
+		return
+	}
+	_, err := dec.DecodeNode()
+	e, ok := err.(*kson.LimitError)
+	if !ok {
+		t.Errorf("decode 2 should return LimitError, actual %v", err)
+		return
+	}
+	ktest.Equal(t, "limit", "MaxBytes", e.Limit)
+	ktest.Equal(t, "offset", len(small)+1024, e.Pos.Offset)
+
+	// a line which never ends
+	dec = kson.NewDecoder(endlessReader{})
+	dec.Limit(kson.Limits{MaxBytes: 1024})
+	_, err = dec.DecodeNode()
+	if e, ok = err.(*kson.LimitError); !ok {
+		t.Errorf("decode endless line should return LimitError, actual %v", err)
+		return
+	}
+	ktest.Equal(t, "limit", "MaxBytes", e.Limit)
+}
+
+// endlessReader reads a literal without newline forever
+type endlessReader struct{}
+
+func (endlessReader) Read(p []byte) (int, error) {
+	for i := range p {
+		p[i] = 'a'
+	}
+	return len(p), nil
+}
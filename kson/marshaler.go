@@ -0,0 +1,84 @@
+// Copyright 2012 by sdm. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package kson
+
+import (
+	"encoding"
+	"github.com/sdming/kiss/gotype"
+	"reflect"
+)
+
+// Marshaler is the interface implemented by types that can marshal themselves into a kson node.
+type Marshaler interface {
+	MarshalKSON() (*Node, error)
+}
+
+// Unmarshaler is the interface implemented by types that can unmarshal a kson node of themselves.
+type Unmarshaler interface {
+	UnmarshalKSON(*Node) error
+}
+
+var (
+	marshalerType       = reflect.TypeOf((*Marshaler)(nil)).Elem()
+	unmarshalerType     = reflect.TypeOf((*Unmarshaler)(nil)).Elem()
+	textMarshalerType   = reflect.TypeOf((*encoding.TextMarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// marshaler return Marshaler or TextMarshaler implemented by v, pointer receiver is used if v is addressable
+func marshaler(v reflect.Value) (m Marshaler, tm encoding.TextMarshaler) {
+	if !v.IsValid() {
+		return
+	}
+	if v.Kind() != reflect.Ptr && v.CanAddr() {
+		pt := reflect.PtrTo(v.Type())
+		if pt.Implements(marshalerType) || pt.Implements(textMarshalerType) {
+			v = v.Addr()
+		}
+	}
+
+	typ := v.Type()
+	if !typ.Implements(marshalerType) && !typ.Implements(textMarshalerType) {
+		return
+	}
+	if (v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface) && v.IsNil() {
+		return
+	}
+
+	if x, ok := v.Interface().(Marshaler); ok {
+		return x, nil
+	}
+	tm, _ = v.Interface().(encoding.TextMarshaler)
+	return
+}
+
+// unmarshaler return Unmarshaler or TextUnmarshaler implemented by address of v
+func unmarshaler(v reflect.Value) (u Unmarshaler, tu encoding.TextUnmarshaler) {
+	if v.Kind() == reflect.Ptr || !v.CanAddr() {
+		return
+	}
+
+	pv := v.Addr()
+	if !pv.Type().Implements(unmarshalerType) && !pv.Type().Implements(textUnmarshalerType) {
+		return
+	}
+
+	if x, ok := pv.Interface().(Unmarshaler); ok {
+		return x, nil
+	}
+	tu, _ = pv.Interface().(encoding.TextUnmarshaler)
+	return
+}
+
+// isPlain return true if value of type t can be parsed from a literal directly
+func isPlain(t reflect.Type) bool {
+	if t == gotype.TypeTime {
+		return true
+	}
+	if !gotype.IsSimple(t.Kind()) {
+		return false
+	}
+	pt := reflect.PtrTo(t)
+	return !pt.Implements(unmarshalerType) && !pt.Implements(textUnmarshalerType)
+}
@@ -0,0 +1,130 @@
+// Copyright 2012 by sdm. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package kson_test
+
+import (
+	"errors"
+	"github.com/sdming/kiss/kson"
+	"github.com/sdming/kiss/ktest"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+)
+
+type Level int
+
+const (
+	LevelDebug Level = iota
+	LevelInfo
+	LevelError
+)
+
+var levelNames = []string{"debug", "info", "error"}
+
+func (l Level) MarshalText() ([]byte, error) {
+	if int(l) < len(levelNames) {
+		return []byte(levelNames[l]), nil
+	}
+	return nil, errors.New("invalid level " + strconv.Itoa(int(l)))
+}
+
+func (l *Level) UnmarshalText(text []byte) error {
+	for i, name := range levelNames {
+		if name == string(text) {
+			*l = Level(i)
+			return nil
+		}
+	}
+	return errors.New("invalid level " + string(text))
+}
+
+// Point is encoded as a list of x, y
+type Point struct {
+	X, Y int
+}
+
+func (p Point) MarshalKSON() (*kson.Node, error) {
+	return &kson.Node{Type: kson.NodeList, List: []*kson.Node{
+		&kson.Node{Type: kson.NodeLiteral, Literal: strconv.Itoa(p.X)},
+		&kson.Node{Type: kson.NodeLiteral, Literal: strconv.Itoa(p.Y)},
+	}}, nil
+}
+
+func (p *Point) UnmarshalKSON(n *kson.Node) (err error) {
+	if n.Type != kson.NodeList || len(n.List) != 2 {
+		return errors.New("point should be a list of x, y")
+	}
+	if p.X, err = strconv.Atoi(n.List[0].Literal); err != nil {
+		return
+	}
+	p.Y, err = strconv.Atoi(n.List[1].Literal)
+	return
+}
+
+type Custom struct {
+	Level  Level
+	Levels []Level
+	Named  map[string]Level
+	Start  time.Time
+	Ip     net.IP
+	Point  Point
+	Points []*Point
+	Raw    *kson.Node
+}
+
+func TestMarshalerRoundTrip(t *testing.T) {
+	start := time.Date(2012, 12, 21, 8, 30, 0, 0, time.UTC)
+	c := Custom{
+		Level:  LevelError,
+		Levels: []Level{LevelInfo, LevelDebug},
+		Named:  map[string]Level{"db": LevelInfo},
+		Start:  start,
+		Ip:     net.ParseIP("10.0.0.1"),
+		Point:  Point{1, 2},
+		Points: []*Point{&Point{3, 4}},
+		Raw:    &kson.Node{Type: kson.NodeLiteral, Literal: "raw"},
+	}
+
+	b, err := kson.Marshal(c)
+	if err != nil {
+		t.Error("marshal error", err)
+		return
+	}
+	s := string(b)
+	t.Log(s)
+
+	for _, x := range []string{"Level:error", "Start:2012-12-21T08:30:00Z", "Ip:10.0.0.1", "Raw:raw"} {
+		if !strings.Contains(s, x) {
+			t.Errorf("marshal should contain %s", x)
+		}
+	}
+
+	var actual Custom
+	if err = kson.Unmarshal(b, &actual); err != nil {
+		t.Error("unmarshal error", err)
+		return
+	}
+
+	ktest.Equal(t, "Level", LevelError, actual.Level)
+	ktest.Equal(t, "Levels", 2, len(actual.Levels))
+	ktest.Equal(t, "Levels[0]", LevelInfo, actual.Levels[0])
+	ktest.Equal(t, "Named", LevelInfo, actual.Named["db"])
+	ktest.Equal(t, "Start", true, start.Equal(actual.Start))
+	ktest.Equal(t, "Ip", "10.0.0.1", actual.Ip.String())
+	ktest.Equal(t, "Point", Point{1, 2}, actual.Point)
+	ktest.Equal(t, "Points", Point{3, 4}, *actual.Points[0])
+	ktest.Equal(t, "Raw", "raw", actual.Raw.Literal)
+}
+
+func TestUnmarshalerError(t *testing.T) {
+	data := "{\n\tLevel:\tfatal\n}\n"
+
+	var c Custom
+	err := kson.Unmarshal([]byte(data), &c)
+	if err == nil || !strings.HasPrefix(err.Error(), "2:9: Level: invalid level fatal") {
+		t.Errorf("unmarshal should return error of text unmarshaler with position, actual %v", err)
+	}
+}
@@ -0,0 +1,55 @@
+// Copyright 2012 by sdm. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package kson
+
+// MergeMarker is a list item of override, items of base list are put at its place when merge.
+// [ ..., x ] appends x to base list, [ x, ... ] puts x before base list.
+// it's reserved in lists merged onto a base list only, it's a literal of other lists, such as lists of base.
+const MergeMarker = "..."
+
+// Merge return a deep merge of base and override, base and override are not modified.
+// Hashes are merged recursively, keys of base are first.
+// A list replaces base list unless it has a MergeMarker item, other nodes of override replace base.
+func Merge(base, override *Node) *Node {
+	if base == nil {
+		if override == nil {
+			return nil
+		}
+		return override.Clone()
+	}
+	if override == nil {
+		return base.Clone()
+	}
+
+	switch {
+	case base.Type == NodeHash && override.Type == NodeHash:
+		node := base.Clone()
+		for _, name := range override.orderedKeys() {
+			if x, ok := node.Hash[name]; ok {
+				node.Hash[name] = Merge(x, override.Hash[name])
+			} else {
+				node.put(name, override.Hash[name].Clone())
+			}
+		}
+		return node
+	case base.Type == NodeList && override.Type == NodeList:
+		node := *override
+		node.List = make([]*Node, 0, len(base.List)+len(override.List))
+		for _, x := range override.List {
+			if isMergeMarker(x) {
+				for _, y := range base.List {
+					node.List = append(node.List, y.Clone())
+				}
+			} else {
+				node.List = append(node.List, x.Clone())
+			}
+		}
+		return &node
+	}
+	return override.Clone()
+}
+
+func isMergeMarker(n *Node) bool {
+	return n.Type == NodeLiteral && n.Literal == MergeMarker
+}
@@ -0,0 +1,119 @@
+// Copyright 2012 by sdm. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package kson_test
+
+import (
+	"github.com/sdming/kiss/kson"
+	"github.com/sdming/kiss/ktest"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var mergeBase = `
+{
+	Log_Level:	debug
+	Hosts:	[
+		a
+		b
+	]
+	Tags:	[
+		x
+	]
+	Db_Log:	{
+		Host:	127.0.0.1
+		User:	user
+	}
+}
+`
+
+var mergeOverride = `
+{
+	Log_Level:	info
+	Hosts:	[
+		c
+	]
+	Tags:	[
+		...
+		y
+	]
+	Db_Log:	{
+		Host:	10.0.0.1
+		Port:	3306
+	}
+	New:	[
+		...
+		z
+	]
+}
+`
+
+func TestMerge(t *testing.T) {
+	base, _ := kson.Parse([]byte(mergeBase))
+	override, _ := kson.Parse([]byte(mergeOverride))
+	node := kson.Merge(base, override)
+
+	ktest.Equal(t, "literal", "info", node.ChildString("Log_Level"))
+	ktest.Equal(t, "list replace", `["c"]`, string(node.MustChild("Hosts").JSON(false)))
+	ktest.Equal(t, "list append", `["x","y"]`, string(node.MustChild("Tags").JSON(false)))
+	ktest.Equal(t, "marker without base", `["...","z"]`, string(node.MustChild("New").JSON(false)))
+	ktest.Equal(t, "hash", `{"Host":"10.0.0.1","User":"user","Port":"3306"}`, string(node.MustChild("Db_Log").JSON(false)))
+	ktest.Equal(t, "keys", "[Log_Level Hosts Tags Db_Log New]", fmtKeys(node.Keys))
+
+	ktest.Equal(t, "base is not modified", "127.0.0.1", base.MustChild("Db_Log").ChildString("Host"))
+	ktest.Equal(t, "override is not modified", 2, len(override.MustChild("Tags").List))
+	ktest.Equal(t, "nil base", "info", kson.Merge(nil, override).ChildString("Log_Level"))
+	ktest.Equal(t, "nil base keeps marker", 2, len(kson.Merge(nil, override).MustChild("Tags").List))
+	ktest.Equal(t, "nil override", "debug", kson.Merge(base, nil).ChildString("Log_Level"))
+}
+
+func TestParseFileInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "kson")
+	if err != nil {
+		t.Error("create temp dir error", err)
+		return
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"base.kson":      "Log_Level:\tdebug\nListen:\t8000\nDb_Log:\t{\n\tinclude:\tdb/db.kson\n\tUser:\troot\n}\n",
+		"db/db.kson":     "Host:\t127.0.0.1\nUser:\tuser\n",
+		"prod.kson":      "include:\tbase.kson\nLog_Level:\terror\n",
+		"host.kson":      "Listen:\t9000\n",
+		"cycle.kson":     "include:\t[\n\tbase.kson\n\tcycle2.kson\n]\n",
+		"cycle2.kson":    "include:\tcycle.kson\n",
+		"not_found.kson": "a:\t1\ninclude:\tnot_found/x.kson\n",
+	}
+	for name, data := range files {
+		os.MkdirAll(filepath.Dir(filepath.Join(dir, name)), 0755)
+		if err := ioutil.WriteFile(filepath.Join(dir, name), []byte(data), 0644); err != nil {
+			t.Error("write file error", err)
+			return
+		}
+	}
+
+	node, err := kson.ParseFiles(filepath.Join(dir, "prod.kson"), filepath.Join(dir, "host.kson"))
+	if err != nil {
+		t.Error("ParseFiles error", err)
+		return
+	}
+	ktest.Equal(t, "override of include", "error", node.ChildString("Log_Level"))
+	ktest.Equal(t, "override of second file", "9000", node.ChildString("Listen"))
+	ktest.Equal(t, "nested include", `{"Host":"127.0.0.1","User":"root"}`, string(node.MustChild("Db_Log").JSON(false)))
+	if _, ok := node.Child("include"); ok {
+		t.Error("include directive should be removed")
+	}
+
+	_, err = kson.ParseFileInclude(filepath.Join(dir, "cycle.kson"))
+	if err == nil || !strings.Contains(err.Error(), "include cycle") {
+		t.Error("include cycle should be reported", err)
+	}
+
+	_, err = kson.ParseFileInclude(filepath.Join(dir, "not_found.kson"))
+	if err == nil || !strings.Contains(err.Error(), "not_found.kson:2:10: include: ") {
+		t.Error("missing include file should be reported with position", err)
+	}
+}
@@ -0,0 +1,111 @@
+// Copyright 2012 by sdm. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package kson
+
+import (
+	"github.com/sdming/kiss/gotype"
+	"reflect"
+	"sync"
+)
+
+// typePlan is what encoder and decoder need to know about a type, it's built once for each type,
+// so repeated Marshal and Unmarshal of the same type don't look up fields, tags and methods by reflect.
+type typePlan struct {
+	typ  reflect.Type
+	kind reflect.Kind
+
+	plain   bool // can be parsed from a literal directly, see isPlain
+	time    bool // typ or elem of pointer typ is time.Time
+	mapKey  bool // typ is a map whose keys can be parsed from names, see isMapKey
+	textKey bool // typ is a map whose keys implement TextMarshaler
+
+	marshaler    bool // typ implements Marshaler or TextMarshaler
+	ptrMarshaler bool // *typ implements Marshaler or TextMarshaler
+	unmarshaler  bool // *typ implements Unmarshaler or TextUnmarshaler
+
+	fields []field     // fields of struct
+	names  []string    // names of fields
+	direct bool        // all fields of struct are written, none is omitempty or in a struct embedded by pointer
+	once   sync.Once   // elem and fplans are set at the first use, so recursive types can be planned
+	elem   *typePlan   // plan of element of array, slice, map or pointer
+	fplans []*typePlan // plans of fields
+}
+
+// plans is a cache of *typePlan by reflect.Type
+var plans sync.Map
+
+// planOf return plan of type t
+func planOf(t reflect.Type) *typePlan {
+	if p, ok := plans.Load(t); ok {
+		return p.(*typePlan)
+	}
+	p, _ := plans.LoadOrStore(t, newPlan(t))
+	return p.(*typePlan)
+}
+
+func newPlan(t reflect.Type) *typePlan {
+	kind := t.Kind()
+	pt := reflect.PtrTo(t)
+	p := &typePlan{
+		typ:          t,
+		kind:         kind,
+		plain:        isPlain(t),
+		time:         t == gotype.TypeTime || (kind == reflect.Ptr && t.Elem() == gotype.TypeTime),
+		marshaler:    t.Implements(marshalerType) || t.Implements(textMarshalerType),
+		ptrMarshaler: kind != reflect.Ptr && (pt.Implements(marshalerType) || pt.Implements(textMarshalerType)),
+		unmarshaler:  kind != reflect.Ptr && (pt.Implements(unmarshalerType) || pt.Implements(textUnmarshalerType)),
+	}
+
+	switch kind {
+	case reflect.Struct:
+		p.fields = typeFields(t)
+		p.names = make([]string, len(p.fields))
+		p.direct = true
+		for i, f := range p.fields {
+			p.names[i] = f.name
+			p.direct = p.direct && !f.omitEmpty && !viaPointer(t, f.index)
+		}
+	case reflect.Map:
+		p.mapKey = isMapKey(t.Key())
+		p.textKey = t.Key().Implements(textMarshalerType)
+	}
+	return p
+}
+
+// viaPointer return true if the field at index of struct t is in a struct embedded by pointer
+func viaPointer(t reflect.Type, index []int) bool {
+	for _, x := range index[:len(index)-1] {
+		if t = t.Field(x).Type; t.Kind() == reflect.Ptr {
+			return true
+		}
+	}
+	return false
+}
+
+// children set plans of element and fields
+func (p *typePlan) children() {
+	p.once.Do(func() {
+		switch p.kind {
+		case reflect.Array, reflect.Slice, reflect.Map, reflect.Ptr:
+			p.elem = planOf(p.typ.Elem())
+		case reflect.Struct:
+			p.fplans = make([]*typePlan, len(p.fields))
+			for i, f := range p.fields {
+				p.fplans[i] = planOf(f.typ)
+			}
+		}
+	})
+}
+
+// elemPlan return plan of element of array, slice, map or pointer
+func (p *typePlan) elemPlan() *typePlan {
+	p.children()
+	return p.elem
+}
+
+// fieldPlan return plan of the ith field of struct
+func (p *typePlan) fieldPlan(i int) *typePlan {
+	p.children()
+	return p.fplans[i]
+}
@@ -0,0 +1,345 @@
+// Copyright 2012 by sdm. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package kson
+
+import (
+	"errors"
+	"strconv"
+	"strings"
+)
+
+/*
+Query path syntax
+
+	Db_Log.Host           key of hash, space is same as .
+	Roles[0]              item of list, Roles[-1] is the last one
+	Roles[*]  Env.*       all items of list or all children of hash
+	Roles[Name=user]      items of list which child Name is user, != is also supported
+	Env["auth.url"]       quoted key, for key contains . [ ] or space
+*/
+
+const (
+	selectKey = iota
+	selectIndex
+	selectAll
+	selectFilter
+)
+
+// selector is an element of query path
+type selector struct {
+	kind  int
+	key   string // key of hash, or child name of filter
+	index int
+	value string // value of filter
+	not   bool   // filter is !=
+}
+
+// parseQuery split path into selectors
+func parseQuery(path string) ([]selector, error) {
+	sels := make([]selector, 0, 4)
+	s := path
+	dot := false // last token is .
+	for s != "" {
+		switch c := s[0]; c {
+		case ' ', '\t':
+			s = s[1:]
+		case '.':
+			if dot || len(sels) == 0 {
+				return nil, errors.New("invalid query " + path + ", unexpected .")
+			}
+			dot = true
+			s = s[1:]
+			continue
+		case '[':
+			end, err := bracketEnd(s)
+			if err != nil {
+				return nil, errors.New("invalid query " + path + ", " + err.Error())
+			}
+			sel, err := parseBracket(s[1:end])
+			if err != nil {
+				return nil, errors.New("invalid query " + path + ", " + err.Error())
+			}
+			sels = append(sels, sel)
+			s = s[end+1:]
+		case ']':
+			return nil, errors.New("invalid query " + path + ", unexpected ]")
+		default:
+			i := strings.IndexAny(s, ". \t[]")
+			if i < 0 {
+				i = len(s)
+			}
+			if name := s[:i]; name == "*" {
+				sels = append(sels, selector{kind: selectAll})
+			} else {
+				sels = append(sels, selector{kind: selectKey, key: name})
+			}
+			s = s[i:]
+		}
+		dot = false
+	}
+
+	if dot {
+		return nil, errors.New("invalid query " + path + ", unexpected end")
+	}
+	return sels, nil
+}
+
+// bracketEnd return index of ] which close the [ at s[0]
+func bracketEnd(s string) (int, error) {
+	var quote byte
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote != 0:
+			if c == '\\' && quote == '"' {
+				i++
+			} else if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == ']':
+			return i, nil
+		}
+	}
+	return 0, errors.New("[ is not closed")
+}
+
+// parseBracket parse content between [ and ]
+func parseBracket(s string) (sel selector, err error) {
+	s = strings.TrimSpace(s)
+	switch {
+	case s == "*":
+		sel.kind = selectAll
+		return
+	case s == "":
+		err = errors.New("empty []")
+		return
+	case s[0] == '"' || s[0] == '\'':
+		sel.kind = selectKey
+		sel.key, err = unquoteQuery(s)
+		return
+	}
+
+	if i := strings.IndexByte(s, '='); i > 0 {
+		sel.kind = selectFilter
+		sel.key = s[:i]
+		if strings.HasSuffix(sel.key, "!") {
+			sel.not = true
+			sel.key = sel.key[:len(sel.key)-1]
+		}
+		sel.key = strings.TrimSpace(sel.key)
+		sel.value = strings.TrimSpace(s[i+1:])
+		if sel.key != "" && (sel.key[0] == '"' || sel.key[0] == '\'') {
+			if sel.key, err = unquoteQuery(sel.key); err != nil {
+				return
+			}
+		}
+		if sel.value != "" && (sel.value[0] == '"' || sel.value[0] == '\'') {
+			sel.value, err = unquoteQuery(sel.value)
+		}
+		return
+	}
+
+	sel.kind = selectIndex
+	if sel.index, err = strconv.Atoi(s); err != nil {
+		err = errors.New("invalid index " + s)
+	}
+	return
+}
+
+func unquoteQuery(s string) (string, error) {
+	if len(s) >= 2 && s[0] == '\'' && s[len(s)-1] == '\'' {
+		return s[1 : len(s)-1], nil
+	}
+	x, err := strconv.Unquote(s)
+	if err != nil {
+		return "", errors.New("invalid quoted string " + s)
+	}
+	return x, nil
+}
+
+// parsePath parse a path which selects one node, only keys and indexes are allowed
+func parsePath(path string) ([]selector, error) {
+	sels, err := parseQuery(path)
+	if err != nil {
+		return nil, err
+	}
+	for _, sel := range sels {
+		if sel.kind != selectKey && (sel.kind != selectIndex || sel.index < 0) {
+			return nil, errors.New("invalid path " + path + ", only keys and indexes are allowed")
+		}
+	}
+	return sels, nil
+}
+
+// appendPathKey append key to path, key is quoted if need
+func appendPathKey(path string, key string) string {
+	if key == "" || key == "*" || strings.ContainsAny(key, ". \t[]\"'") {
+		return path + "[" + strconv.Quote(key) + "]"
+	}
+	if path == "" {
+		return key
+	}
+	return path + "." + key
+}
+
+// elem return child of n by key or index
+func (n *Node) elem(sel selector) (child *Node, ok bool) {
+	switch sel.kind {
+	case selectKey:
+		return n.Child(sel.key)
+	case selectIndex:
+		if n.Type == NodeList && sel.index >= 0 && sel.index < len(n.List) {
+			return n.List[sel.index], true
+		}
+	}
+	return
+}
+
+// match append nodes match sel of n to result
+func (n *Node) match(sel selector, result []*Node) []*Node {
+	switch sel.kind {
+	case selectKey, selectIndex:
+		if sel.kind == selectIndex && sel.index < 0 && n.Type == NodeList {
+			sel.index += len(n.List)
+		}
+		if child, ok := n.elem(sel); ok {
+			result = append(result, child)
+		}
+	case selectAll:
+		if n.Type == NodeList {
+			result = append(result, n.List...)
+		} else if n.Type == NodeHash {
+			for _, key := range n.orderedKeys() {
+				result = append(result, n.Hash[key])
+			}
+		}
+	case selectFilter:
+		if n.Type == NodeList {
+			for _, x := range n.List {
+				if x.filter(sel) {
+					result = append(result, x)
+				}
+			}
+		} else if n.filter(sel) {
+			result = append(result, n)
+		}
+	}
+	return result
+}
+
+// filter return true if literal child sel.key of n is (or is not) sel.value
+func (n *Node) filter(sel selector) bool {
+	child, ok := n.Child(sel.key)
+	if !ok || child.Type != NodeLiteral {
+		return sel.not
+	}
+	return (child.Literal == sel.value) != sel.not
+}
+
+// QueryAll return all nodes match path, such as Roles[Name=user].Allow[*]
+func (n *Node) QueryAll(path string) ([]*Node, error) {
+	sels, err := parseQuery(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(sels) == 0 {
+		return nil, errors.New("query is empty")
+	}
+
+	nodes := []*Node{n}
+	for _, sel := range sels {
+		next := make([]*Node, 0, len(nodes))
+		for _, x := range nodes {
+			next = x.match(sel, next)
+		}
+		if nodes = next; len(nodes) == 0 {
+			break
+		}
+	}
+	return nodes, nil
+}
+
+// Query return the first node match path, such as Roles[0].Allow or Db_Log Host
+func (n *Node) Query(path string) (child *Node, ok bool) {
+	nodes, err := n.QueryAll(path)
+	if err != nil || len(nodes) == 0 {
+		return
+	}
+	return nodes[0], true
+}
+
+// query return the first node match path, return NodeNotExistsError if there is none
+func (n *Node) query(path string) (*Node, error) {
+	nodes, err := n.QueryAll(path)
+	if err != nil {
+		return nil, err
+	}
+	if len(nodes) == 0 {
+		return nil, &NodeNotExistsError{Name: path, Pos: n.Pos}
+	}
+	return nodes[0], nil
+}
+
+// QueryInt return value of path as int64
+func (n *Node) QueryInt(path string) (int64, error) {
+	x, err := n.query(path)
+	if err != nil {
+		return 0, err
+	}
+	return x.Int()
+}
+
+// QueryUint return value of path as uint64
+func (n *Node) QueryUint(path string) (uint64, error) {
+	x, err := n.query(path)
+	if err != nil {
+		return 0, err
+	}
+	return x.Uint()
+}
+
+// QueryFloat return value of path as float64
+func (n *Node) QueryFloat(path string) (float64, error) {
+	x, err := n.query(path)
+	if err != nil {
+		return 0, err
+	}
+	return x.Float()
+}
+
+// QueryBool return value of path as bool
+func (n *Node) QueryBool(path string) (bool, error) {
+	x, err := n.query(path)
+	if err != nil {
+		return false, err
+	}
+	return x.Bool()
+}
+
+// QueryString return value of path as string
+func (n *Node) QueryString(path string) (string, error) {
+	x, err := n.query(path)
+	if err != nil {
+		return "", err
+	}
+	return x.String()
+}
+
+// QueryStrings return literals of all nodes match path
+func (n *Node) QueryStrings(path string) ([]string, error) {
+	nodes, err := n.QueryAll(path)
+	if err != nil {
+		return nil, err
+	}
+
+	data := make([]string, 0, len(nodes))
+	for _, x := range nodes {
+		if x.Type == NodeLiteral {
+			data = append(data, x.Literal)
+		}
+	}
+	return data, nil
+}
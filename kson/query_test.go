@@ -0,0 +1,94 @@
+// Copyright 2012 by sdm. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package kson_test
+
+import (
+	"github.com/sdming/kiss/kson"
+	"github.com/sdming/kiss/ktest"
+	"testing"
+)
+
+func TestQuery(t *testing.T) {
+	node, err := kson.Parse([]byte(defaultConfigString))
+	if err != nil {
+		t.Error("parse error", err)
+		return
+	}
+
+	strings := func(path string) string {
+		data, err := node.QueryStrings(path)
+		if err != nil {
+			return err.Error()
+		}
+		return fmtKeys(data)
+	}
+
+	ktest.Equal(t, "key", "[127.0.0.1]", strings("Db_Log.Host"))
+	ktest.Equal(t, "space", "[127.0.0.1]", strings("Db_Log Host"))
+	ktest.Equal(t, "index", "[/order]", strings("Roles[0].Allow[1]"))
+	ktest.Equal(t, "last", "[*]", strings("Roles[-1].Name"))
+	ktest.Equal(t, "all of list", "[/user /order]", strings("Roles[0].Allow[*]"))
+	ktest.Equal(t, "all of hash", "[http://auth.io ie, chrome, firefox, safari ]", strings("Env.*"))
+	ktest.Equal(t, "filter", "[/user /order]", strings("Roles[Name=user].Allow[*]"))
+	ktest.Equal(t, "filter not", "[*]", strings("Roles[Name!=user].Name"))
+	ktest.Equal(t, "quoted filter", "[/order]", strings(`Roles[Name="*"].Deny[-1]`))
+	ktest.Equal(t, "quoted key", "[http://auth.io]", strings(`Env["auth"]`))
+	ktest.Equal(t, "filter hash", "[log]", strings("Db_Log[Driver=mysql].Database"))
+	ktest.Equal(t, "wildcard", "[user *]", strings("Roles[*].Name"))
+	ktest.Equal(t, "not exists", "[]", strings("Roles[2].Name"))
+
+	for _, path := range []string{"", "Roles[", "Roles[x]", ".Roles", "Db_Log..Host", "Db_Log.", `Env["auth]`} {
+		if _, err := node.QueryAll(path); err == nil {
+			t.Errorf("query %q should fail", path)
+		}
+	}
+
+	// a key with . is quoted, unquoted it's a path of two keys
+	dotted, err := kson.Parse([]byte("{\n\tauth.url:\thttp://auth.io\n}"))
+	if err != nil {
+		t.Error("parse dotted key error", err)
+		return
+	}
+	_, ok := dotted.Query("auth.url")
+	ktest.Equal(t, "dotted key unquoted", false, ok)
+	url, _ := dotted.QueryString(`["auth.url"]`)
+	ktest.Equal(t, "dotted key quoted", "http://auth.io", url)
+
+	if n, ok := node.Query("Roles[1].Deny[0]"); !ok || n.Literal != "/user" {
+		t.Error("Query Roles[1].Deny[0] fail", n, ok)
+	}
+	if _, ok := node.Query("Roles[Name=admin]"); ok {
+		t.Error("Query Roles[Name=admin] should fail")
+	}
+}
+
+func TestQueryTyped(t *testing.T) {
+	node, err := kson.Parse([]byte(defaultConfigString))
+	if err != nil {
+		t.Error("parse error", err)
+		return
+	}
+
+	i, err := node.QueryInt("Listen")
+	ktest.Equal(t, "QueryInt", int64(8000), i)
+	ktest.Equal(t, "QueryInt error", nil, err)
+
+	u, _ := node.QueryUint("Listen")
+	ktest.Equal(t, "QueryUint", uint64(8000), u)
+
+	f, _ := node.QueryFloat("Listen")
+	ktest.Equal(t, "QueryFloat", float64(8000), f)
+
+	s, _ := node.QueryString("Roles[Name=user].Allow[0]")
+	ktest.Equal(t, "QueryString", "/user", s)
+
+	if _, err := node.QueryBool("Log_Level"); err == nil {
+		t.Error("QueryBool of debug should fail")
+	}
+
+	_, err = node.QueryInt("Db_Log.Port")
+	if _, ok := err.(*kson.NodeNotExistsError); !ok {
+		t.Errorf("QueryInt of missing path should return NodeNotExistsError, actual %v", err)
+	}
+}
@@ -0,0 +1,431 @@
+// Copyright 2012 by sdm. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package kson
+
+import (
+	"errors"
+	"fmt"
+	"github.com/sdming/kiss/gotype"
+	"reflect"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+// types of Schema
+const (
+	SchemaAny      = ""
+	SchemaString   = "string"
+	SchemaInt      = "int"
+	SchemaUint     = "uint"
+	SchemaFloat    = "float"
+	SchemaBool     = "bool"
+	SchemaDuration = "duration"
+	SchemaTime     = "time"
+	SchemaList     = "list"
+	SchemaHash     = "hash"
+)
+
+// Schema describes shape of a node, it can be written in kson, such as
+//
+//	type:	hash
+//	closed:	true
+//	keys:	{
+//		Listen:	{
+//			type:	int
+//			required:	true
+//			min:	1
+//			max:	65535
+//		}
+//		Log_Level:	{
+//			type:	string
+//			in:	[
+//				debug
+//				info
+//			]
+//		}
+//		Hosts:	{
+//			type:	list
+//			items:	{
+//				type:	string
+//			}
+//		}
+//	}
+//
+// or derived from a go type by SchemaOf.
+type Schema struct {
+	Type      string             `kson:"type,omitempty"` // one of Schema* types, any type if empty
+	Doc       string             `kson:"doc,omitempty"`
+	Required  bool               `kson:"required,omitempty"`   // key must exist and is not null or empty
+	Nullable  bool               `kson:"nullable,omitempty"`   // null is allowed
+	In        []string           `kson:"in,omitempty"`         // allowed literals
+	Match     string             `kson:"match,omitempty"`      // regexp which the whole literal must match
+	Min       *float64           `kson:"min,omitempty"`        // min of int, uint or float
+	Max       *float64           `kson:"max,omitempty"`        // max of int, uint or float
+	MinLength *int               `kson:"min_length,omitempty"` // min length of string, list or hash
+	MaxLength *int               `kson:"max_length,omitempty"` // max length of string, list or hash
+	Items     *Schema            `kson:"items,omitempty"`      // schema of items of list
+	Keys      map[string]*Schema `kson:"keys,omitempty"`       // schema of items of hash
+	Values    *Schema            `kson:"values,omitempty"`     // schema of items of hash which are not in Keys
+	Closed    bool               `kson:"closed,omitempty"`     // items which are not in Keys are errors if Values is nil
+
+	match *regexp.Regexp
+}
+
+// ParseSchema parse kson data to a schema
+func ParseSchema(data []byte) (*Schema, error) {
+	node, err := Parse(data)
+	if err != nil {
+		return nil, err
+	}
+	return nodeSchema(node)
+}
+
+// ParseSchemaFile parse a kson file to a schema, content of file is a hash without { and }, see ParseFile
+func ParseSchemaFile(filename string) (*Schema, error) {
+	node, err := ParseFile(filename)
+	if err != nil {
+		return nil, err
+	}
+	return nodeSchema(node)
+}
+
+func nodeSchema(node *Node) (*Schema, error) {
+	s := &Schema{}
+	if err := node.ValueStrict(s); err != nil {
+		return nil, err
+	}
+	if err := s.Compile(); err != nil {
+		return nil, err
+	}
+	return s, nil
+}
+
+// Compile check type names and compile Match of s and its children, it's called by ParseSchema.
+// Schema built in go code should be compiled before Validate.
+func (s *Schema) Compile() error {
+	return s.compile("")
+}
+
+func (s *Schema) compile(path string) error {
+	if s.Type == SchemaAny {
+		if s.Keys != nil || s.Values != nil || s.Closed {
+			s.Type = SchemaHash
+		} else if s.Items != nil {
+			s.Type = SchemaList
+		}
+	}
+
+	switch s.Type {
+	case SchemaAny, SchemaString, SchemaInt, SchemaUint, SchemaFloat, SchemaBool, SchemaDuration, SchemaTime, SchemaList, SchemaHash:
+	default:
+		return &ValueError{Path: path, Err: errors.New("unknown schema type " + s.Type)}
+	}
+
+	if s.Match != "" {
+		re, err := regexp.Compile("^(?:" + s.Match + ")$")
+		if err != nil {
+			return &ValueError{Path: path, Err: err}
+		}
+		s.match = re
+	}
+
+	if s.Items != nil {
+		if err := s.Items.compile(path + "[*]"); err != nil {
+			return err
+		}
+	}
+	for name, x := range s.Keys {
+		if x == nil {
+			x = &Schema{}
+			s.Keys[name] = x
+		}
+		if err := x.compile(appendPathKey(path, name)); err != nil {
+			return err
+		}
+	}
+	if s.Values != nil {
+		if err := s.Values.compile(appendPathKey(path, "*")); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Validate check node by s, problems are returned as MultiError, each error has path and position of node
+func (s *Schema) Validate(node *Node) error {
+	v := &schemaValidator{}
+	v.validate(s, node, "")
+	if len(v.errs) > 0 {
+		sort.Stable(byOffset(v.errs))
+		return MultiError(v.errs)
+	}
+	return nil
+}
+
+type schemaValidator struct {
+	errs []error
+}
+
+func (v *schemaValidator) report(n *Node, path string, format string, a ...interface{}) {
+	v.errs = append(v.errs, &ValueError{Pos: n.Pos, Path: path, Err: fmt.Errorf(format, a...)})
+}
+
+func (v *schemaValidator) validate(s *Schema, n *Node, path string) {
+	if n.Type == NodeNull {
+		if !s.Nullable && s.Type != SchemaAny {
+			v.report(n, path, "null is not allowed")
+		}
+		return
+	}
+
+	switch s.Type {
+	case SchemaAny:
+	case SchemaList:
+		if n.Type != NodeList {
+			v.report(n, path, "expect list, got %s", nameOfNodeType(n.Type))
+			return
+		}
+	case SchemaHash:
+		if n.Type != NodeHash {
+			v.report(n, path, "expect hash, got %s", nameOfNodeType(n.Type))
+			return
+		}
+	default:
+		if n.Type != NodeLiteral {
+			v.report(n, path, "expect %s, got %s", s.Type, nameOfNodeType(n.Type))
+			return
+		}
+	}
+
+	switch n.Type {
+	case NodeLiteral:
+		v.validateLiteral(s, n, path)
+	case NodeList:
+		v.validateLength(s, n, path, len(n.List))
+		if s.Items != nil {
+			for i, child := range n.List {
+				v.validate(s.Items, child, path+"["+strconv.Itoa(i)+"]")
+			}
+		}
+	case NodeHash:
+		v.validateLength(s, n, path, len(n.Hash))
+		v.validateHash(s, n, path)
+	}
+}
+
+func (v *schemaValidator) validateLiteral(s *Schema, n *Node, path string) {
+	literal := n.Literal
+	if literal == "" {
+		if s.Type == SchemaString || s.Type == SchemaAny {
+			v.validateLength(s, n, path, 0)
+		}
+		return // empty value, see Required
+	}
+
+	var number float64
+	var err error
+	switch s.Type {
+	case SchemaInt:
+		var i int64
+		i, err = strconv.ParseInt(literal, 0, 64)
+		number = float64(i)
+	case SchemaUint:
+		var u uint64
+		u, err = strconv.ParseUint(literal, 0, 64)
+		number = float64(u)
+	case SchemaFloat:
+		number, err = strconv.ParseFloat(literal, 64)
+	case SchemaBool:
+		_, err = strconv.ParseBool(literal)
+	case SchemaDuration:
+		_, err = gotype.ParseDuration(literal)
+	case SchemaTime:
+		_, err = gotype.ParseTime(literal)
+	}
+	if err != nil {
+		v.report(n, path, "literal %s is not %s", strconv.Quote(literal), s.Type)
+		return
+	}
+
+	switch s.Type {
+	case SchemaInt, SchemaUint, SchemaFloat:
+		if s.Min != nil && number < *s.Min {
+			v.report(n, path, "%s is less than %v", literal, *s.Min)
+		}
+		if s.Max != nil && number > *s.Max {
+			v.report(n, path, "%s is greater than %v", literal, *s.Max)
+		}
+	}
+
+	if s.In != nil && !containsString(s.In, literal) {
+		v.report(n, path, "%s is not one of %s", strconv.Quote(literal), strings.Join(s.In, ", "))
+	}
+	if s.match != nil && !s.match.MatchString(literal) {
+		v.report(n, path, "%s does not match %s", strconv.Quote(literal), s.Match)
+	}
+	if s.Type == SchemaString || s.Type == SchemaAny {
+		v.validateLength(s, n, path, utf8.RuneCountInString(literal))
+	}
+}
+
+func (v *schemaValidator) validateLength(s *Schema, n *Node, path string, length int) {
+	if s.MinLength != nil && length < *s.MinLength {
+		v.report(n, path, "length %d is less than %d", length, *s.MinLength)
+	}
+	if s.MaxLength != nil && length > *s.MaxLength {
+		v.report(n, path, "length %d is greater than %d", length, *s.MaxLength)
+	}
+}
+
+func (v *schemaValidator) validateHash(s *Schema, n *Node, path string) {
+	for _, name := range n.orderedKeys() {
+		child := n.Hash[name]
+		x, ok := s.Keys[name]
+		if !ok {
+			x, ok = s.keyFold(name)
+		}
+		if !ok {
+			x = s.Values
+		}
+		if x != nil {
+			v.validate(x, child, appendPathKey(path, name))
+		} else if s.Closed {
+			v.report(child, appendPathKey(path, name), "unknown key %s", name)
+		}
+	}
+
+	names := make([]string, 0, len(s.Keys))
+	for name, x := range s.Keys {
+		if x.Required {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		child, ok := n.ChildFold(name)
+		if !ok || child.Type == NodeNull || (child.Type == NodeLiteral && child.Literal == "") {
+			v.report(n, appendPathKey(path, name), "required key %s is missing", name)
+		}
+	}
+}
+
+// keyFold return schema of key under Unicode case-folding, keys are matched like Node.Value
+func (s *Schema) keyFold(name string) (*Schema, bool) {
+	for key, x := range s.Keys {
+		if strings.EqualFold(key, name) {
+			return x, true
+		}
+	}
+	return nil, false
+}
+
+func containsString(a []string, s string) bool {
+	for _, x := range a {
+		if x == s {
+			return true
+		}
+	}
+	return false
+}
+
+// SchemaOf derive a schema from type of v, struct fields are keys of hash and unknown keys are errors,
+// fields with tag option required are required, such as `kson:"port,required"`
+func SchemaOf(v interface{}) *Schema {
+	s := typeSchema(reflect.TypeOf(v), nil)
+	s.Compile()
+	return s
+}
+
+// typeSchema return schema of t, types in parents are not expanded again, so recursive types end
+func typeSchema(t reflect.Type, parents []reflect.Type) *Schema {
+	s := &Schema{}
+	if t == nil {
+		return s
+	}
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+		s.Nullable = true
+	}
+	switch t.Kind() {
+	case reflect.Slice, reflect.Map, reflect.Interface:
+		s.Nullable = true // Marshal writes nil as null
+	}
+
+	switch {
+	case t == gotype.TypeTime:
+		s.Type = SchemaTime
+		return s
+	case t == gotype.TypeDuration:
+		s.Type = SchemaDuration
+		return s
+	case reflect.PtrTo(t).Implements(unmarshalerType):
+		return s
+	case reflect.PtrTo(t).Implements(textUnmarshalerType):
+		s.Type = SchemaString
+		return s
+	}
+
+	for _, p := range parents {
+		if p == t {
+			s.Type = kindSchemaType(t.Kind())
+			return s
+		}
+	}
+	parents = append(parents, t)
+
+	switch t.Kind() {
+	case reflect.Bool:
+		s.Type = SchemaBool
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		s.Type = SchemaInt
+		if bits := t.Bits(); bits < 64 {
+			min, max := -float64(int64(1)<<uint(bits-1)), float64(int64(1)<<uint(bits-1)-1)
+			s.Min, s.Max = &min, &max
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		s.Type = SchemaUint
+		if bits := t.Bits(); bits < 64 {
+			max := float64(uint64(1)<<uint(bits) - 1)
+			s.Max = &max
+		}
+	case reflect.Float32, reflect.Float64:
+		s.Type = SchemaFloat
+	case reflect.String:
+		s.Type = SchemaString
+	case reflect.Slice, reflect.Array:
+		s.Type = SchemaList
+		s.Items = typeSchema(t.Elem(), parents)
+		if t.Kind() == reflect.Array {
+			max := t.Len()
+			s.MaxLength = &max
+		}
+	case reflect.Map:
+		s.Type = SchemaHash
+		s.Values = typeSchema(t.Elem(), parents)
+	case reflect.Struct:
+		s.Type = SchemaHash
+		s.Closed = true
+		s.Keys = make(map[string]*Schema)
+		for _, f := range planOf(t).fields {
+			x := typeSchema(f.typ, parents)
+			x.Required = f.required
+			s.Keys[f.name] = x
+		}
+	}
+	return s
+}
+
+// kindSchemaType return schema type of kind, it's used for recursive types
+func kindSchemaType(kind reflect.Kind) string {
+	switch kind {
+	case reflect.Slice, reflect.Array:
+		return SchemaList
+	case reflect.Map, reflect.Struct:
+		return SchemaHash
+	}
+	return SchemaAny
+}
@@ -0,0 +1,219 @@
+// Copyright 2012 by sdm. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package kson_test
+
+import (
+	"github.com/sdming/kiss/kson"
+	"github.com/sdming/kiss/ktest"
+	"strings"
+	"testing"
+	"time"
+)
+
+var schemaData = `
+{
+	type:	hash
+	closed:	true
+	keys:	{
+		Listen:	{
+			type:	int
+			required:	true
+			min:	1
+			max:	65535
+		}
+		Log_Level:	{
+			type:	string
+			in:	[
+				debug
+				info
+				error
+			]
+		}
+		Timeout:	{
+			type:	duration
+		}
+		Roles:	{
+			type:	list
+			max_length:	2
+			items:	{
+				closed:	true
+				keys:	{
+					Name:	{
+						required:	true
+						match:	"[a-z*]+"
+					}
+					Allow:	{
+						items:	{
+							type:	string
+						}
+					}
+					Deny:	{
+						type:	list
+					}
+				}
+			}
+		}
+		Db_Log:	{
+			type:	hash
+		}
+		Env:	{
+			values:	{
+				type:	string
+				max_length:	32
+			}
+		}
+	}
+}
+`
+
+var schemaConfig = `
+{
+	Listen:	0
+	Log_Level:	trace
+	Timeout:	30x
+	Roles:	[
+		{
+			Name:	User
+			Allow:	[
+				{
+				}
+			]
+		}
+		{
+			Allow:	[
+			]
+			Deny:	typo
+		}
+		{
+			Name:	admin
+		}
+	]
+	Env:	{
+		key:
+		auth:	http://auth.long-long-example.com
+	}
+	Unknown:	1
+}
+`
+
+func TestSchemaValidate(t *testing.T) {
+	s, err := kson.ParseSchema([]byte(schemaData))
+	if err != nil {
+		t.Error("ParseSchema error", err)
+		return
+	}
+
+	node, _ := kson.Parse([]byte(defaultConfigString))
+	if err = s.Validate(node); err != nil {
+		t.Error("default config should be valid", err)
+	}
+
+	node, _ = kson.Parse([]byte(schemaConfig))
+	err = s.Validate(node)
+	errs, ok := err.(kson.MultiError)
+	if !ok {
+		t.Error("Validate should return MultiError", err)
+		return
+	}
+
+	expects := []string{
+		"3:10: Listen: 0 is less than 1",
+		`4:13: Log_Level: "trace" is not one of debug, info, error`,
+		`5:11: Timeout: literal "30x" is not duration`,
+		"6:9: Roles: length 3 is greater than 2",
+		`8:10: Roles[0].Name: "User" does not match [a-z*]+`,
+		"10:5: Roles[0].Allow[0]: expect string, got hash",
+		"14:3: Roles[1].Name: required key Name is missing",
+		"17:10: Roles[1].Deny: expect list, got literal",
+		"25:9: Env.auth: length 33 is greater than 32",
+		"27:11: Unknown: unknown key Unknown",
+	}
+	actual := make([]string, len(errs))
+	for i, e := range errs {
+		actual[i] = e.Error()
+	}
+	ktest.Equal(t, "errors", strings.Join(expects, "\n"), strings.Join(actual, "\n"))
+
+	for _, bad := range []string{"{\n\ttype:\tnumber\n}\n", "{\n\tmatch:\t\"[a-\"\n}\n", "{\n\ttypo:\tint\n}\n"} {
+		if _, err := kson.ParseSchema([]byte(bad)); err == nil {
+			t.Errorf("ParseSchema %q should fail", bad)
+		}
+	}
+}
+
+type SchemaConfig struct {
+	Port    uint16 `kson:"port,required"`
+	Level   int8
+	Timeout time.Duration
+	Start   *time.Time
+	Hosts   []string
+	Pair    [2]int
+	Env     map[string]int
+	Db      Db
+	Next    *SchemaConfig
+}
+
+func TestSchemaOf(t *testing.T) {
+	s := kson.SchemaOf(SchemaConfig{})
+	ktest.Equal(t, "type", kson.SchemaHash, s.Type)
+	ktest.Equal(t, "required", true, s.Keys["port"].Required)
+	ktest.Equal(t, "uint16", 65535.0, *s.Keys["port"].Max)
+	ktest.Equal(t, "int8", -128.0, *s.Keys["Level"].Min)
+	ktest.Equal(t, "duration", kson.SchemaDuration, s.Keys["Timeout"].Type)
+	ktest.Equal(t, "pointer", true, s.Keys["Start"].Nullable)
+	ktest.Equal(t, "nil slice", true, s.Keys["Hosts"].Nullable)
+	ktest.Equal(t, "nil map", true, s.Keys["Env"].Nullable)
+	ktest.Equal(t, "array", false, s.Keys["Pair"].Nullable)
+	ktest.Equal(t, "slice", kson.SchemaString, s.Keys["Hosts"].Items.Type)
+	ktest.Equal(t, "array", 2, *s.Keys["Pair"].MaxLength)
+	ktest.Equal(t, "map", kson.SchemaInt, s.Keys["Env"].Values.Type)
+	ktest.Equal(t, "struct", kson.SchemaString, s.Keys["Db"].Keys["Host"].Type)
+	ktest.Equal(t, "recursive", true, s.Keys["Next"].Keys == nil && s.Keys["Next"].Type == kson.SchemaHash)
+
+	node, _ := kson.Parse([]byte("{\n\tLevel:\t200\n\tTimeout:\t1m\n\tStart:\tnull\n\tEnv:\t{\n\t\ta:\tb\n\t}\n\tdb:\t{\n\t\tHost:\tlocalhost\n\t}\n}\n"))
+	err := s.Validate(node)
+	if err == nil || len(err.(kson.MultiError)) != 3 {
+		t.Error("Validate should report 3 errors", err)
+	}
+
+	// schema of schema can be published, and parsed back
+	b, err := kson.MarshalIndent(s, "\t")
+	if err != nil {
+		t.Error("marshal schema error", err)
+		return
+	}
+	back, err := kson.ParseSchema(b)
+	if err != nil {
+		t.Error("parse marshaled schema error", err, string(b))
+		return
+	}
+	ktest.Equal(t, "round trip", 65535.0, *back.Keys["port"].Max)
+	ktest.Equal(t, "round trip", true, back.Keys["port"].Required)
+}
+
+type SchemaNils struct {
+	Hosts []string
+	Env   map[string]int
+	Extra interface{}
+	Next  *SchemaNils
+	Items []SchemaNils
+}
+
+func TestSchemaOfMarshal(t *testing.T) {
+	for _, v := range []interface{}{SchemaConfig{}, SchemaNils{}, SchemaNils{Items: []SchemaNils{{Extra: "x"}}}} {
+		b, err := kson.Marshal(v)
+		if err != nil {
+			t.Error("marshal error", err)
+			continue
+		}
+		node, err := kson.Parse(b)
+		if err != nil {
+			t.Error("parse marshaled error", err, string(b))
+			continue
+		}
+		if err := kson.SchemaOf(v).Validate(node); err != nil {
+			t.Errorf("output of Marshal %T should be valid, %v\n%s", v, err, b)
+		}
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2012 by sdm. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package kson
+
+import (
+	"sync"
+)
+
+// slabSize is the max count of nodes, list items or keys in a chunk of slab
+const slabSize = 1024
+
+// slab allocates nodes, lists and keys of a parse in chunks instead of one by one.
+// a chunk is kept alive as long as any node of it is used.
+type slab struct {
+	size  int // count of nodes expected
+	count int // count of nodes allocated
+	items int // count of list items and keys allocated, it's count of nodes but the top one at the end
+	nodes []Node
+	lists []*Node
+	keys  []string
+}
+
+// newSlab return a slab for about n nodes
+func newSlab(n int) slab {
+	return slab{size: n}
+}
+
+// chunkSize return size of a chunk for n of want still expected
+func chunkSize(n int, want int) int {
+	if want > slabSize {
+		want = slabSize
+	}
+	if n > want {
+		return n
+	}
+	return want
+}
+
+// node return a new node
+func (s *slab) node() *Node {
+	if len(s.nodes) == 0 {
+		if s.count >= s.size {
+			s.size = 2 * s.count
+		}
+		s.nodes = make([]Node, chunkSize(1, s.size-s.count))
+	}
+	n := &s.nodes[0]
+	s.nodes = s.nodes[1:]
+	s.count++
+	return n
+}
+
+// want return count of items expected for lists or keys, half of them are guessed for each
+func (s *slab) want(n int) int {
+	if s.items+n > s.size {
+		s.size = 2 * (s.items + n)
+	}
+	s.items += n
+	return (s.size - s.items + n) / 2
+}
+
+// list return a copy of nodes of items, appending to it doesn't overwrite other lists
+func (s *slab) list(items []item) []*Node {
+	n := len(items)
+	if n == 0 {
+		return make([]*Node, 0)
+	}
+	want := s.want(n)
+	if n > len(s.lists) {
+		s.lists = make([]*Node, chunkSize(n, want))
+	}
+	list := s.lists[:n:n]
+	s.lists = s.lists[n:]
+	for i, x := range items {
+		list[i] = x.node
+	}
+	return list
+}
+
+// strings return an empty slice of capacity n for keys
+func (s *slab) strings(n int) []string {
+	want := s.want(n)
+	if n > len(s.keys) {
+		s.keys = make([]string, chunkSize(n, want))
+	}
+	keys := s.keys[:0:n]
+	s.keys = s.keys[n:]
+	return keys
+}
+
+// span is src[start:end] of a parse, keys are kept as spans on stack, so there are less pointers to write
+type span struct {
+	start, end int
+}
+
+// item is a child of an open list or hash, name is empty for list items
+type item struct {
+	name span
+	node *Node
+}
+
+// frame is a list, hash or item which is being parsed
+type frame struct {
+	state int
+	off   int   // where an item starts
+	name  span  // key of hash item
+	node  *Node // nil until the value of item is read
+	items int   // index of the first child in parseStack.items
+}
+
+// parseStack is the stack of a parse, it's reused by later parses
+type parseStack struct {
+	frames []frame
+	items  []item // children of open lists and hashes
+
+	// max lengths of frames and items, those after them are not used yet
+	maxFrames int
+	maxItems  int
+}
+
+var stackPool = sync.Pool{
+	New: func() interface{} {
+		return &parseStack{
+			frames: make([]frame, 0, 16),
+			items:  make([]item, 0, 64),
+		}
+	},
+}
+
+// release clear stack and put it back to pool, nodes are not referenced by it any more
+func (ps *parseStack) release() {
+	if cap(ps.items) > 64*slabSize {
+		return
+	}
+	if len(ps.frames) > ps.maxFrames {
+		ps.maxFrames = len(ps.frames)
+	}
+	if len(ps.items) > ps.maxItems {
+		ps.maxItems = len(ps.items)
+	}
+	frames, items := ps.frames[:ps.maxFrames], ps.items[:ps.maxItems]
+	for i := range frames {
+		frames[i].node = nil
+	}
+	for i := range items {
+		items[i].node = nil
+	}
+	ps.frames, ps.items = frames[:0], items[:0]
+	ps.maxFrames, ps.maxItems = 0, 0
+	stackPool.Put(ps)
+}
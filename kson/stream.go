@@ -0,0 +1,209 @@
+// Copyright 2012 by sdm. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package kson
+
+import (
+	"bufio"
+	"bytes"
+	"io"
+)
+
+// A Decoder reads and decodes kson values from an input stream.
+type Decoder struct {
+	r     io.Reader
+	opts  DecoderOptions
+	buf   []byte
+	scanp int // start of unread data in buf
+	eof   bool
+	err   error
+
+	// position of buf[scanp] in the stream
+	offset int
+	line   int
+
+	// last value is not finished, buf[:checked] has been parsed
+	short   bool
+	checked int
+}
+
+// NewDecoder returns a new decoder that reads from r.
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: r}
+}
+
+// Strict causes Decode to report problems like UnmarshalStrict.
+func (dec *Decoder) Strict() {
+	dec.opts.Strict = true
+}
+
+// Infer causes Decode to convert literals to bool, int64, float64 or nil when they are decoded into interface{}.
+func (dec *Decoder) Infer() {
+	dec.opts.Infer = true
+}
+
+// AppendSlices causes Decode to append items of lists to existing slices, see DecoderOptions.
+func (dec *Decoder) AppendSlices() {
+	dec.opts.AppendSlices = true
+}
+
+// Limit causes Decode and DecodeNode to return a *LimitError if a value exceeds limits,
+// MaxBytes bounds each value and the data buffered for it.
+func (dec *Decoder) Limit(limits Limits) {
+	dec.opts.Limits = limits
+}
+
+// Decode reads the next kson value from its input and stores it in the value pointed to by v.
+func (dec *Decoder) Decode(v interface{}) error {
+	node, err := dec.DecodeNode()
+	if err != nil {
+		return err
+	}
+	return node.ValueOptions(v, dec.opts)
+}
+
+// DecodeNode reads the next kson value from its input, return io.EOF if there is no more value
+func (dec *Decoder) DecodeNode() (node *Node, err error) {
+	if dec.err != nil {
+		return nil, dec.err
+	}
+
+	for {
+		// only complete lines are parsed, so a value never ends in the middle of line
+		end := len(dec.buf)
+		if !dec.eof {
+			end = bytes.LastIndex(dec.buf[dec.scanp:], []byte{'\n'}) + 1 + dec.scanp
+		}
+
+		if end > dec.scanp {
+			d := newDecoder(dec.buf[dec.scanp:end])
+			d.one = true
+			d.more = !dec.eof
+			d.offBase = dec.offset
+			d.lineBase = dec.line
+			d.limits = dec.opts.Limits
+
+			node, err = d.parse()
+			dec.short = err == errShort
+			if dec.short {
+				dec.checked = end
+			} else {
+				if err != nil {
+					dec.err = err
+					return
+				}
+				dec.advance(d.off)
+				if node.Type == NodeNone {
+					return nil, io.EOF
+				}
+				return
+			}
+		} else if dec.eof {
+			return nil, io.EOF
+		}
+
+		if err = dec.checkBuffered(); err != nil {
+			dec.err = err
+			return nil, err
+		}
+		if err = dec.refill(); err != nil {
+			dec.err = err
+			return nil, err
+		}
+	}
+}
+
+// advance skip n bytes and the end of current line
+func (dec *Decoder) advance(n int) {
+	if i := dec.scanp + n; i < len(dec.buf) && dec.buf[i] == '\n' {
+		n++
+	}
+	consumed := dec.buf[dec.scanp : dec.scanp+n]
+	dec.offset += n
+	dec.line += bytes.Count(consumed, []byte{'\n'})
+	dec.scanp += n
+	dec.checked = dec.scanp
+}
+
+// refill read data until there is a line may close current value
+func (dec *Decoder) refill() error {
+	for {
+		if dec.scanp > 0 {
+			n := copy(dec.buf, dec.buf[dec.scanp:])
+			dec.buf = dec.buf[:n]
+			dec.checked -= dec.scanp
+			dec.scanp = 0
+		}
+
+		const minRead = 512
+		if cap(dec.buf)-len(dec.buf) < minRead {
+			newBuf := make([]byte, len(dec.buf), 2*cap(dec.buf)+minRead)
+			copy(newBuf, dec.buf)
+			dec.buf = newBuf
+		}
+
+		n, err := dec.r.Read(dec.buf[len(dec.buf):cap(dec.buf)])
+		dec.buf = dec.buf[:len(dec.buf)+n]
+		if err == io.EOF {
+			dec.eof = true
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		if dec.closerIn() {
+			return nil
+		}
+		// no value ends in buffer, such as a line never ends, so it's checked before reading more
+		if err := dec.checkBuffered(); err != nil {
+			return err
+		}
+	}
+}
+
+// closerIn return true if new complete lines may finish current value,
+// so a large value is not parsed again and again on every read.
+func (dec *Decoder) closerIn() bool {
+	end := bytes.LastIndex(dec.buf, []byte{'\n'}) + 1
+	if end <= dec.checked {
+		return false
+	}
+	data := dec.buf[dec.checked:end]
+	dec.checked = end
+	return !dec.short || bytes.IndexAny(data, "]}\"`") >= 0
+}
+
+// An Encoder writes kson values to an output stream.
+type Encoder struct {
+	w    *bufio.Writer
+	buf  bytes.Buffer // lines of the value being encoded, they are written to w every flushSize bytes
+	opts EncoderOptions
+}
+
+// NewEncoder returns a new encoder that writes to w.
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: bufio.NewWriter(w)}
+}
+
+// SetOptions set format of following values, TrailingNewline is ignored since each value is followed by a newline.
+func (enc *Encoder) SetOptions(opts EncoderOptions) {
+	enc.opts = opts
+}
+
+// Encode writes the kson encoding of v to the stream, followed by a newline character.
+// Lines are written while v is encoded, so a large value is not kept in memory,
+// if v fails to encode, lines of it before the error may have been written.
+func (enc *Encoder) Encode(v interface{}) error {
+	enc.buf.Reset()
+	e := &encoder{Buffer: &enc.buf, w: enc.w, opts: enc.opts}
+	err := e.encode(v)
+	if err == nil {
+		enc.buf.WriteByte('\n')
+		_, err = enc.w.Write(enc.buf.Bytes())
+	}
+	enc.buf.Reset()
+	if flushErr := enc.w.Flush(); err == nil {
+		err = flushErr
+	}
+	return err
+}
@@ -0,0 +1,191 @@
+// Copyright 2012 by sdm. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package kson_test
+
+import (
+	"bytes"
+	"github.com/sdming/kiss/kson"
+	"github.com/sdming/kiss/ktest"
+	"io"
+	"strings"
+	"testing"
+	"testing/iotest"
+)
+
+var streamData = `
+{
+	Name:	one
+	Int:	1
+}
+	{
+		Name:	two
+		Quote:	"
+	}
+"
+	}
+
+[
+	a
+	b
+]
+literal
+"quoted
+literal"
+`
+
+func testDecoderStream(t *testing.T, name string, r io.Reader) {
+	dec := kson.NewDecoder(r)
+
+	var p1, p2 Poco
+	if err := dec.Decode(&p1); err != nil {
+		t.Errorf("%s: decode 1 error %v", name, err)
+		return
+	}
+	ktest.Equal(t, name+" p1.Name", "one", p1.Name)
+	ktest.Equal(t, name+" p1.Int", 1, p1.Int)
+
+	if err := dec.Decode(&p2); err != nil {
+		t.Errorf("%s: decode 2 error %v", name, err)
+		return
+	}
+	ktest.Equal(t, name+" p2.Name", "two", p2.Name)
+	ktest.Equal(t, name+" p2.Quote", "\n\t}\n", p2.Quote)
+
+	var list []string
+	if err := dec.Decode(&list); err != nil {
+		t.Errorf("%s: decode 3 error %v", name, err)
+		return
+	}
+	ktest.Equal(t, name+" list", 2, len(list))
+
+	node, err := dec.DecodeNode()
+	if err != nil {
+		t.Errorf("%s: decode 4 error %v", name, err)
+		return
+	}
+	ktest.Equal(t, name+" literal", "literal", node.Literal)
+	ktest.Equal(t, name+" literal pos", "17:1", node.Pos.String())
+
+	node, err = dec.DecodeNode()
+	if err != nil {
+		t.Errorf("%s: decode 5 error %v", name, err)
+		return
+	}
+	ktest.Equal(t, name+" quoted", "quoted\nliteral", node.Literal)
+
+	if _, err = dec.DecodeNode(); err != io.EOF {
+		t.Errorf("%s: decode should return io.EOF at end, actual %v", name, err)
+	}
+}
+
+func TestDecoderStream(t *testing.T) {
+	testDecoderStream(t, "reader", strings.NewReader(streamData))
+	testDecoderStream(t, "one byte reader", iotest.OneByteReader(strings.NewReader(streamData)))
+	testDecoderStream(t, "half reader", iotest.HalfReader(strings.NewReader(streamData)))
+}
+
+func TestDecoderError(t *testing.T) {
+	dec := kson.NewDecoder(strings.NewReader("{\n\ta: 1\n}\n{\n\tbad\n}\n"))
+
+	if _, err := dec.DecodeNode(); err != nil {
+		t.Error("decode 1 error", err)
+		return
+	}
+	_, err := dec.DecodeNode()
+	if e, ok := err.(*kson.FormatError); !ok || e.Pos.Line != 5 {
+		t.Errorf("decode 2 should return FormatError at line 5, actual %v", err)
+	}
+}
+
+func TestEncoderStream(t *testing.T) {
+	var buf bytes.Buffer
+	enc := kson.NewEncoder(&buf)
+
+	values := []interface{}{
+		Poco{Name: "one", Int: 1},
+		"literal",
+		[]string{"a", "b"},
+		1024,
+	}
+	for _, v := range values {
+		if err := enc.Encode(v); err != nil {
+			t.Error("encode error", err)
+			return
+		}
+	}
+
+	dec := kson.NewDecoder(&buf)
+	var p Poco
+	if err := dec.Decode(&p); err != nil {
+		t.Error("decode error", err)
+		return
+	}
+	ktest.Equal(t, "poco name", "one", p.Name)
+
+	var s string
+	dec.Decode(&s)
+	ktest.Equal(t, "literal", "literal", s)
+
+	var list []string
+	dec.Decode(&list)
+	ktest.Equal(t, "list", 2, len(list))
+
+	var i int
+	dec.Decode(&i)
+	ktest.Equal(t, "int", 1024, i)
+
+	if err := dec.Decode(&i); err != io.EOF {
+		t.Errorf("decode should return io.EOF at end, actual %v", err)
+	}
+}
+
+func TestEncoderError(t *testing.T) {
+	var buf bytes.Buffer
+	enc := kson.NewEncoder(&buf)
+
+	if err := enc.Encode([]interface{}{"before", Level(99)}); err == nil {
+		t.Error("encode invalid level should fail")
+	}
+	ktest.Equal(t, "nothing of a short value written", "", buf.String())
+
+	if err := enc.Encode("after"); err != nil {
+		t.Error("encode error", err)
+		return
+	}
+	ktest.Equal(t, "only the value after error", "after\n", buf.String())
+}
+
+// countWriter counts calls of Write
+type countWriter struct {
+	bytes.Buffer
+	writes int
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.writes++
+	return w.Buffer.Write(p)
+}
+
+func TestEncoderLarge(t *testing.T) {
+	var w countWriter
+	enc := kson.NewEncoder(&w)
+	items := make([]string, 5000)
+	for i := range items {
+		items[i] = "item"
+	}
+	if err := enc.Encode(items); err != nil {
+		t.Error("encode error", err)
+		return
+	}
+	if w.writes < 2 {
+		t.Errorf("large value should be written while it's encoded, writes %d", w.writes)
+	}
+
+	var list []string
+	if err := kson.NewDecoder(&w.Buffer).Decode(&list); err != nil {
+		t.Error("decode error", err)
+		return
+	}
+	ktest.Equal(t, "items", len(items), len(list))
+}
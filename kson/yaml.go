@@ -0,0 +1,423 @@
+// Copyright 2012 by sdm. All rights reserved.
+// license that can be found in the LICENSE file.
+
+package kson
+
+import (
+	"bytes"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+/*
+YAML subset
+
+Only block style is supported: mappings of "key: value", sequences of "- item", plain, 'single' and "double" quoted scalars,
+empty [] and {}, comments and document marker ---. Anchors, tags, multi-line scalars and flow style are not supported.
+null and ~ become null nodes, an empty value is an empty literal.
+*/
+
+// YAML return node as yaml, keys of hash are in source order.
+// Literals that yaml would read as other types are quoted, unless infer is true and literal is true, false, null or a number.
+func (n *Node) YAML(infer bool) []byte {
+	var buf bytes.Buffer
+	switch {
+	case n.Type == NodeHash && len(n.Hash) > 0:
+		writeYAMLHash(&buf, n, "", "", infer)
+	case n.Type == NodeList && len(n.List) > 0:
+		writeYAMLList(&buf, n, "", "", infer)
+	default:
+		writeYAMLValue(&buf, n, infer)
+		buf.WriteByte('\n')
+	}
+	return buf.Bytes()
+}
+
+// writeYAMLHash write items of hash, lead is written instead of indent before the first item
+func writeYAMLHash(buf *bytes.Buffer, n *Node, indent, lead string, infer bool) {
+	for i, name := range n.orderedKeys() {
+		if i == 0 {
+			buf.WriteString(lead)
+		} else {
+			buf.WriteString(indent)
+		}
+		writeYAMLScalar(buf, name, false)
+		buf.WriteByte(':')
+
+		child := n.Hash[name]
+		if isYAMLBlock(child) {
+			buf.WriteByte('\n')
+			writeYAMLBlock(buf, child, indent+"  ", indent+"  ", infer)
+		} else {
+			buf.WriteByte(' ')
+			writeYAMLValue(buf, child, infer)
+			buf.WriteByte('\n')
+		}
+	}
+}
+
+// writeYAMLList write items of list, lead is written instead of indent before the first item
+func writeYAMLList(buf *bytes.Buffer, n *Node, indent, lead string, infer bool) {
+	for i, child := range n.List {
+		if i == 0 {
+			buf.WriteString(lead)
+		} else {
+			buf.WriteString(indent)
+		}
+		buf.WriteString("- ")
+
+		if isYAMLBlock(child) {
+			writeYAMLBlock(buf, child, indent+"  ", "", infer)
+		} else {
+			writeYAMLValue(buf, child, infer)
+			buf.WriteByte('\n')
+		}
+	}
+}
+
+func writeYAMLBlock(buf *bytes.Buffer, n *Node, indent, lead string, infer bool) {
+	if n.Type == NodeHash {
+		writeYAMLHash(buf, n, indent, lead, infer)
+	} else {
+		writeYAMLList(buf, n, indent, lead, infer)
+	}
+}
+
+// isYAMLBlock return true if n is a not empty list or hash
+func isYAMLBlock(n *Node) bool {
+	return (n.Type == NodeHash && len(n.Hash) > 0) || (n.Type == NodeList && len(n.List) > 0)
+}
+
+// writeYAMLValue write literal or empty list and hash
+func writeYAMLValue(buf *bytes.Buffer, n *Node, infer bool) {
+	switch n.Type {
+	case NodeLiteral:
+		writeYAMLScalar(buf, n.Literal, infer)
+	case NodeList:
+		buf.WriteString("[]")
+	case NodeHash:
+		buf.WriteString("{}")
+	default:
+		buf.WriteString("null")
+	}
+}
+
+func writeYAMLScalar(buf *bytes.Buffer, s string, infer bool) {
+	if infer && isInferred(s) {
+		buf.WriteString(s)
+	} else if yamlNeedQuote(s) {
+		writeJSONString(buf, s)
+	} else {
+		buf.WriteString(s)
+	}
+}
+
+// yamlNeedQuote return true if s is not a plain yaml string
+func yamlNeedQuote(s string) bool {
+	if s == "" || s != strings.TrimSpace(s) || strings.ContainsAny(s[:1], "-?:,[]{}#&*!|>'\"%@`") {
+		return true
+	}
+	if strings.Contains(s, ": ") || strings.Contains(s, " #") || strings.HasSuffix(s, ":") {
+		return true
+	}
+	for i := 0; i < len(s); i++ {
+		if s[i] < 0x20 || s[i] == 0x7f {
+			return true
+		}
+	}
+
+	switch strings.ToLower(s) {
+	case "true", "false", "yes", "no", "on", "off", "y", "n", "null", "~", ".inf", "-.inf", ".nan":
+		return true
+	}
+	if _, err := strconv.ParseFloat(s, 64); err == nil {
+		return true
+	}
+	if _, err := strconv.ParseInt(s, 0, 64); err == nil {
+		return true
+	}
+	return false
+}
+
+type yamlLine struct {
+	indent int
+	text   string
+	line   int
+}
+
+type yamlParser struct {
+	lines []yamlLine
+	i     int
+}
+
+// ParseYAML convert yaml to node, see YAML subset
+func ParseYAML(data []byte) (*Node, error) {
+	p := &yamlParser{}
+	for i, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimRight(line, " \t\r")
+		text := strings.TrimLeft(line, " ")
+		if text == "" || text[0] == '#' || text == "---" || text == "..." {
+			continue
+		}
+		if text[0] == '\t' {
+			return nil, &FormatError{Message: "tab is not allowed in indentation", Pos: Position{Line: i + 1, Column: 1}}
+		}
+		p.lines = append(p.lines, yamlLine{indent: len(line) - len(text), text: stripYAMLComment(text), line: i + 1})
+	}
+
+	if len(p.lines) == 0 {
+		return &Node{Type: NodeLiteral}, nil
+	}
+
+	first := p.lines[0]
+	node, err := p.parseBlock(first.indent)
+	if err != nil {
+		return nil, err
+	}
+	if p.i < len(p.lines) {
+		return nil, p.error(p.lines[p.i], "unexpected indentation")
+	}
+	return node, nil
+}
+
+func (p *yamlParser) error(l yamlLine, msg string) *FormatError {
+	return &FormatError{Message: msg, Pos: Position{Line: l.line, Column: l.indent + 1}}
+}
+
+// stripYAMLComment remove " # comment" which is not in quotes
+func stripYAMLComment(s string) string {
+	var quote byte
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case quote == '"' && c == '\\':
+			i++
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case (c == '"' || c == '\'') && (i == 0 || s[i-1] == ' '):
+			quote = c
+		case c == '#' && i > 0 && s[i-1] == ' ':
+			return strings.TrimRight(s[:i], " \t")
+		}
+	}
+	return s
+}
+
+func isYAMLItem(text string) bool {
+	return text == "-" || strings.HasPrefix(text, "- ")
+}
+
+// parseBlock parse the list or hash whose lines start at indent
+func (p *yamlParser) parseBlock(indent int) (*Node, error) {
+	l := p.lines[p.i]
+	if isYAMLItem(l.text) {
+		return p.parseList(indent)
+	}
+	if _, _, ok := splitYAMLEntry(l.text); ok {
+		return p.parseHash(indent)
+	}
+
+	// a single scalar
+	p.i++
+	return p.scalar(l, l.text)
+}
+
+func (p *yamlParser) parseList(indent int) (*Node, error) {
+	node := &Node{Type: NodeList, List: make([]*Node, 0, capacity), Pos: p.pos(p.lines[p.i])}
+	for p.i < len(p.lines) {
+		l := p.lines[p.i]
+		if l.indent < indent || (l.indent == indent && !isYAMLItem(l.text)) {
+			break
+		}
+		if l.indent > indent {
+			return nil, p.error(l, "expect - item")
+		}
+
+		child, err := p.parseValue(l, strings.TrimLeft(l.text[1:], " "), indent)
+		if err != nil {
+			return nil, err
+		}
+		node.List = append(node.List, child)
+	}
+	return node, nil
+}
+
+func (p *yamlParser) parseHash(indent int) (*Node, error) {
+	node := newHash()
+	node.Pos = p.pos(p.lines[p.i])
+	for p.i < len(p.lines) {
+		l := p.lines[p.i]
+		if l.indent < indent {
+			break
+		}
+		name, value, ok := splitYAMLEntry(l.text)
+		if l.indent > indent || !ok {
+			return nil, p.error(l, "expect key: value")
+		}
+
+		key, err := p.scalar(l, name)
+		if err != nil {
+			return nil, err
+		}
+		if _, ok := node.Hash[key.Literal]; ok {
+			return nil, p.error(l, "duplicate key "+key.Literal)
+		}
+
+		child, err := p.parseValue(l, value, indent)
+		if err != nil {
+			return nil, err
+		}
+		node.put(key.Literal, child)
+	}
+	return node, nil
+}
+
+// parseValue parse value after "key:" or "-" of line l, and the block under it
+func (p *yamlParser) parseValue(l yamlLine, value string, indent int) (*Node, error) {
+	if value == "" {
+		p.i++
+		if p.i < len(p.lines) {
+			next := p.lines[p.i]
+			if next.indent > indent || (next.indent == indent && isYAMLItem(next.text) && !isYAMLItem(l.text)) {
+				return p.parseBlock(next.indent)
+			}
+		}
+		return &Node{Type: NodeLiteral, Pos: p.pos(l)}, nil
+	}
+
+	// "- key: value" or "- - item", the rest of line is the first line of a block
+	if isYAMLItem(l.text) {
+		if _, _, ok := splitYAMLEntry(value); ok || isYAMLItem(value) {
+			p.lines[p.i] = yamlLine{indent: l.indent + len(l.text) - len(value), text: value, line: l.line}
+			return p.parseBlock(p.lines[p.i].indent)
+		}
+	}
+
+	p.i++
+	return p.scalar(l, value)
+}
+
+// splitYAMLEntry split "key: value", ok is false if text is not a hash item
+func splitYAMLEntry(text string) (name, value string, ok bool) {
+	start := 0
+	if text != "" && (text[0] == '"' || text[0] == '\'') {
+		end := -1
+		for i := 1; i < len(text); i++ {
+			if text[0] == '"' && text[i] == '\\' {
+				i++
+			} else if text[i] == text[0] {
+				end = i
+				break
+			}
+		}
+		if end < 0 {
+			return
+		}
+		start = end + 1
+	}
+
+	i := strings.Index(text[start:], ": ")
+	if i < 0 {
+		if !strings.HasSuffix(text, ":") || len(text)-1 < start {
+			return
+		}
+		return text[:len(text)-1], "", true
+	}
+	i += start
+	return strings.TrimRight(text[:i], " "), strings.TrimSpace(text[i+2:]), true
+}
+
+func (p *yamlParser) pos(l yamlLine) Position {
+	return Position{Line: l.line, Column: l.indent + 1}
+}
+
+// scalar convert text to a literal node
+func (p *yamlParser) scalar(l yamlLine, text string) (*Node, error) {
+	node := &Node{Type: NodeLiteral, Pos: p.pos(l)}
+	switch {
+	case text == "":
+	case text == "~" || text == "null":
+		node.Type = NodeNull
+	case text == "[]":
+		node.Type, node.List = NodeList, make([]*Node, 0)
+	case text == "{}":
+		node.Type, node.Hash = NodeHash, make(map[string]*Node)
+	case text[0] == '"':
+		s, ok := yamlUnquote(text)
+		if !ok {
+			return nil, p.error(l, "invalid double quoted string "+text)
+		}
+		node.Literal = s
+	case text[0] == '\'':
+		if len(text) < 2 || text[len(text)-1] != '\'' {
+			return nil, p.error(l, "invalid single quoted string "+text)
+		}
+		node.Literal = strings.Replace(text[1:len(text)-1], "''", "'", -1)
+	case strings.ContainsAny(text[:1], "[{&*!|>%@`"):
+		return nil, p.error(l, "unsupported yaml syntax "+text)
+	default:
+		node.Literal = text
+	}
+	return node, nil
+}
+
+// yamlEscapes are escapes of double quoted yaml scalars but \x, \u and \U
+var yamlEscapes = map[byte]string{
+	'0': "\x00", 'a': "\a", 'b': "\b", 't': "\t", '\t': "\t", 'n': "\n", 'v': "\v", 'f': "\f", 'r': "\r",
+	'e': "\x1b", ' ': " ", '"': "\"", '/': "/", '\\': "\\",
+	'N': "\u0085", '_': "\u00a0", 'L': "\u2028", 'P': "\u2029",
+}
+
+// yamlUnquote decode a double quoted yaml scalar by escapes of yaml 1.2, they are not the same as go,
+// such as \e, \N, \_ and \xXX which is a code point rather than a byte
+func yamlUnquote(text string) (string, bool) {
+	if len(text) < 2 || text[0] != '"' || text[len(text)-1] != '"' {
+		return "", false
+	}
+	s := text[1 : len(text)-1]
+
+	var buf bytes.Buffer
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		if c == '"' {
+			return "", false
+		} else if c != '\\' {
+			buf.WriteByte(c)
+			continue
+		}
+
+		i++
+		if i == len(s) {
+			return "", false
+		}
+		if e, ok := yamlEscapes[s[i]]; ok {
+			buf.WriteString(e)
+			continue
+		}
+
+		n := 0
+		switch s[i] {
+		case 'x':
+			n = 2
+		case 'u':
+			n = 4
+		case 'U':
+			n = 8
+		default:
+			return "", false
+		}
+		if i+n >= len(s) {
+			return "", false
+		}
+		r, err := strconv.ParseUint(s[i+1:i+1+n], 16, 32)
+		if err != nil || !utf8.ValidRune(rune(r)) {
+			return "", false
+		}
+		buf.WriteRune(rune(r))
+		i += n
+	}
+	return buf.String(), true
+}